@@ -2,29 +2,54 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/metrics"
 )
 
+// 发送请求并读取响应，记录耗时和网络错误
+func fetch(name string, req *http.Request) ([]byte, error) {
+	start := time.Now()
+	client := &http.Client{Timeout: 10 * time.Second}
+	var body []byte
+	resp, err := client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		body, err = ioutil.ReadAll(resp.Body)
+	}
+	metrics.APICall(name, time.Since(start).Seconds())
+	if err != nil {
+		metrics.APIError(name, "network")
+		return nil, err
+	}
+	return body, nil
+}
+
+// B站明确回复房间不存在，区别于网络错误和限流等临时错误
+var ErrRoomNotFound = errors.New("房间不存在")
+
+// 房间不存在时get_info返回的错误码
+var roomNotFoundCodes = map[int]bool{1: true, 60004: true}
+
 // 获取真实房间ID
 func GetRealRoomID(roomID int) (int, error) {
 	apiURL := "https://api.live.bilibili.com/room/v1/Room/get_info"
 	params := url.Values{}
 	params.Add("room_id", fmt.Sprintf("%d", roomID))
 
-	resp, err := http.Get(apiURL + "?" + params.Encode())
+	req, err := http.NewRequest("GET", apiURL+"?"+params.Encode(), nil)
 	if err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := fetch("get_info", req)
 	if err != nil {
 		return 0, err
 	}
@@ -37,12 +62,20 @@ func GetRealRoomID(roomID int) (int, error) {
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
+		metrics.APIError("get_info", "invalid")
 		return 0, err
 	}
 
 	if result.Code != 0 {
+		metrics.APIError("get_info", strconv.Itoa(result.Code))
+		if roomNotFoundCodes[result.Code] {
+			return 0, fmt.Errorf("%w: %d", ErrRoomNotFound, roomID)
+		}
 		return 0, fmt.Errorf("获取真实房间ID失败: %d", result.Code)
 	}
+	if result.Data.RoomID == 0 {
+		return 0, fmt.Errorf("%w: %d", ErrRoomNotFound, roomID)
+	}
 
 	return result.Data.RoomID, nil
 }
@@ -63,14 +96,7 @@ func GetDanmuInfo(realRoomID int) (string, []map[string]interface{}, error) {
 		req.Header.Set("Cookie", config.GetConfig().Cookie)
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := fetch("getDanmuInfo", req)
 	if err != nil {
 		return "", nil, err
 	}
@@ -84,10 +110,12 @@ func GetDanmuInfo(realRoomID int) (string, []map[string]interface{}, error) {
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
+		metrics.APIError("getDanmuInfo", "invalid")
 		return "", nil, err
 	}
 
 	if result.Code != 0 {
+		metrics.APIError("getDanmuInfo", strconv.Itoa(result.Code))
 		return "", nil, fmt.Errorf("获取弹幕信息失败: %d", result.Code)
 	}
 
@@ -96,13 +124,16 @@ func GetDanmuInfo(realRoomID int) (string, []map[string]interface{}, error) {
 
 // 获取Buvid3
 func GetRealBuvid3() (string, error) {
-	apis := []string{
-		"https://api.bilibili.com/x/web-frontend/getbuvid",
-		"https://api.bilibili.com/x/frontend/finger/spi",
+	apis := []struct {
+		name string
+		url  string
+	}{
+		{"getbuvid", "https://api.bilibili.com/x/web-frontend/getbuvid"},
+		{"spi", "https://api.bilibili.com/x/frontend/finger/spi"},
 	}
 
 	for _, api := range apis {
-		req, err := http.NewRequest("GET", api, nil)
+		req, err := http.NewRequest("GET", api.url, nil)
 		if err != nil {
 			continue
 		}
@@ -112,14 +143,7 @@ func GetRealBuvid3() (string, error) {
 			req.Header.Set("Cookie", config.GetConfig().Cookie)
 		}
 
-		client := &http.Client{Timeout: 10 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			continue
-		}
-		defer resp.Body.Close()
-
-		body, err := ioutil.ReadAll(resp.Body)
+		body, err := fetch(api.name, req)
 		if err != nil {
 			continue
 		}
@@ -145,7 +169,69 @@ func GetRealBuvid3() (string, error) {
 		if err := json.Unmarshal(body, &spiResp); err == nil && spiResp.Code == 0 {
 			return spiResp.Data.B3, nil
 		}
+		metrics.APIError(api.name, "invalid")
 	}
 
 	return "", fmt.Errorf("无法获取Buvid3")
 }
+
+// 历史弹幕
+type HistoryDanmu struct {
+	Text       string          `json:"text"`
+	UID        int64           `json:"uid"`
+	Nickname   string          `json:"nickname"`
+	Timeline   string          `json:"timeline"` // 发送时间，如 2006-01-02 15:04:05 (北京时间)
+	GuardLevel int             `json:"guard_level"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+// 获取直播间最近的历史弹幕
+func GetHistory(realRoomID int) ([]HistoryDanmu, error) {
+	apiURL := "https://api.live.bilibili.com/xlive/web-room/v1/dM/gethistory"
+	params := url.Values{}
+	params.Add("roomid", fmt.Sprintf("%d", realRoomID))
+	params.Add("room_type", "0")
+
+	req, err := http.NewRequest("GET", apiURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 添加Cookie
+	if config.GetConfig().Cookie != "" {
+		req.Header.Set("Cookie", config.GetConfig().Cookie)
+	}
+
+	body, err := fetch("gethistory", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Code int `json:"code"`
+		Data struct {
+			Room []json.RawMessage `json:"room"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		metrics.APIError("gethistory", "invalid")
+		return nil, err
+	}
+
+	if result.Code != 0 {
+		metrics.APIError("gethistory", strconv.Itoa(result.Code))
+		return nil, fmt.Errorf("获取历史弹幕失败: %d", result.Code)
+	}
+
+	history := make([]HistoryDanmu, 0, len(result.Data.Room))
+	for _, raw := range result.Data.Room {
+		var item HistoryDanmu
+		if err := json.Unmarshal(raw, &item); err != nil {
+			continue
+		}
+		item.Raw = raw
+		history = append(history, item)
+	}
+	return history, nil
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/config"
+)
+
+// 认证后的调用方身份
+type Identity struct {
+	Name   string // API密钥名称、租户名称或JWT的sub
+	Method string // key、jwt，未开启认证时为空
+	Tenant string // 使用租户密钥时为租户名称
+	Role   Role   // 管理权限，租户密钥没有管理权限
+}
+
+// 未开启认证时所有请求使用的匿名身份，最多只能查看统计，
+// 断开客户端、关闭房间等管理操作必须配置API密钥或JWT密钥后才能使用
+var anonymous = &Identity{Name: "anonymous", Role: RoleViewer}
+
+// 请求没有经过认证时的身份，没有任何管理权限
+var unauthenticated = &Identity{Name: "anonymous"}
+
+type contextKey struct{}
+
+// 是否开启了认证，配置文件中有API密钥、租户或JWT密钥时开启
+func Enabled() bool {
+	cfg := config.GetConfig()
+	return len(cfg.APIKeys) > 0 || len(cfg.Tenants) > 0 || cfg.JWTSecret != ""
+}
+
+// 校验凭证，凭证可以是API密钥或HS256签名的JWT
+func Check(credential string) (*Identity, error) {
+	return CheckAny(credential)
+}
+
+// 依次校验多个凭证，使用第一个有效的凭证，全部无效时只记一次认证失败。
+// 模拟连接的认证包中的key和HTTP请求中的凭证都可以使用
+func CheckAny(credentials ...string) (*Identity, error) {
+	if !Enabled() {
+		return anonymous, nil
+	}
+	var firstErr error
+	for _, c := range credentials {
+		if c == "" {
+			continue
+		}
+		id, err := check(c)
+		if err == nil {
+			return id, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("缺少凭证")
+	}
+	atomic.AddInt64(&unauthorized, 1)
+	return nil, firstErr
+}
+
+func check(credential string) (*Identity, error) {
+	cfg := config.GetConfig()
+	if credential == "" {
+		return nil, fmt.Errorf("缺少凭证")
+	}
+
+	for _, k := range cfg.APIKeys {
+		if k.Key != "" && subtle.ConstantTimeCompare([]byte(k.Key), []byte(credential)) == 1 {
+			return &Identity{Name: k.Name, Method: "key", Role: ParseRole(k.Role)}, nil
+		}
+	}
+	for _, t := range cfg.Tenants {
+		if t.Key != "" && subtle.ConstantTimeCompare([]byte(t.Key), []byte(credential)) == 1 {
+			return &Identity{Name: t.Name, Method: "key", Tenant: t.Name}, nil
+		}
+	}
+
+	if cfg.JWTSecret != "" && strings.Count(credential, ".") == 2 {
+		claims, err := verifyJWT(credential, []byte(cfg.JWTSecret))
+		if err != nil {
+			return nil, err
+		}
+		return &Identity{Name: claims.Sub, Method: "jwt", Role: ParseRole(claims.Role)}, nil
+	}
+	return nil, fmt.Errorf("无效的凭证")
+}
+
+// 从请求中取出凭证并校验。依次查找Authorization: Bearer、X-API-Key头
+// 和token查询参数，浏览器的WebSocket无法设置请求头时使用查询参数。
+func FromRequest(r *http.Request) (*Identity, error) {
+	return Check(Credential(r))
+}
+
+// 请求中的凭证，没有时返回空字符串
+func Credential(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("token")
+}
+
+// 要求请求通过认证，身份保存在请求的context中
+func Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := FromRequest(r)
+		if err != nil {
+			log.Printf("认证失败: %s %s: %v", r.RemoteAddr, r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bilimux"`)
+			http.Error(w, "未授权", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(WithIdentity(r.Context(), id)))
+	}
+}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// 请求的调用方身份，未经过认证时返回没有管理权限的身份
+func FromContext(ctx context.Context) *Identity {
+	if id, ok := ctx.Value(contextKey{}).(*Identity); ok {
+		return id
+	}
+	return unauthenticated
+}
+
+// JWT中使用的字段
+type jwtClaims struct {
+	Sub  string `json:"sub"`
+	Role string `json:"role"`
+	Exp  int64  `json:"exp"`
+	Nbf  int64  `json:"nbf"`
+}
+
+// 校验HS256签名的JWT
+func verifyJWT(token string, secret []byte) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("无效的JWT头: %v", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("不支持的JWT算法: %s", header.Alg)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, fmt.Errorf("JWT签名无效")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("无效的JWT内容: %v", err)
+	}
+	now := time.Now().Unix()
+	if claims.Exp != 0 && now >= claims.Exp {
+		return nil, fmt.Errorf("JWT已过期")
+	}
+	if claims.Nbf != 0 && now < claims.Nbf {
+		return nil, fmt.Errorf("JWT尚未生效")
+	}
+	if claims.Sub == "" {
+		claims.Sub = "jwt"
+	}
+	return &claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/config"
+)
+
+var testSecret = []byte("secret")
+
+// 按指定的头和内容签发JWT
+func signJWT(t *testing.T, header, claims map[string]interface{}, secret []byte) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := segment(header) + "." + segment(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	now := time.Now().Unix()
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	tests := []struct {
+		name     string
+		token    string
+		wantSub  string
+		wantRole string
+		wantErr  string
+	}{
+		{"有效", signJWT(t, hs256, map[string]interface{}{"sub": "bot", "role": "operator", "exp": now + 60}, testSecret), "bot", "operator", ""},
+		{"没有过期时间", signJWT(t, hs256, map[string]interface{}{"sub": "bot"}, testSecret), "bot", "", ""},
+		{"没有sub", signJWT(t, hs256, map[string]interface{}{"exp": now + 60}, testSecret), "jwt", "", ""},
+		{"已生效", signJWT(t, hs256, map[string]interface{}{"sub": "bot", "nbf": now - 1}, testSecret), "bot", "", ""},
+		{"已过期", signJWT(t, hs256, map[string]interface{}{"sub": "bot", "exp": now - 1}, testSecret), "", "", "已过期"},
+		{"恰好过期", signJWT(t, hs256, map[string]interface{}{"sub": "bot", "exp": now}, testSecret), "", "", "已过期"},
+		{"尚未生效", signJWT(t, hs256, map[string]interface{}{"sub": "bot", "nbf": now + 60}, testSecret), "", "", "尚未生效"},
+		{"alg为none", signJWT(t, map[string]interface{}{"alg": "none"}, map[string]interface{}{"sub": "bot"}, testSecret), "", "", "不支持的JWT算法"},
+		{"alg为HS512", signJWT(t, map[string]interface{}{"alg": "HS512"}, map[string]interface{}{"sub": "bot"}, testSecret), "", "", "不支持的JWT算法"},
+		{"alg大小写不同", signJWT(t, map[string]interface{}{"alg": "hs256"}, map[string]interface{}{"sub": "bot"}, testSecret), "", "", "不支持的JWT算法"},
+		{"密钥错误", signJWT(t, hs256, map[string]interface{}{"sub": "bot"}, []byte("other")), "", "", "签名无效"},
+		{"签名不是base64", strings.Join(strings.Split(signJWT(t, hs256, map[string]interface{}{"sub": "bot"}, testSecret), ".")[:2], ".") + ".!!!", "", "", "签名无效"},
+		{"没有签名", strings.Join(strings.Split(signJWT(t, hs256, map[string]interface{}{"sub": "bot"}, testSecret), ".")[:2], ".") + ".", "", "", "签名无效"},
+		{"头不是JSON", "bm90IGpzb24.e30.sig", "", "", "无效的JWT头"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifyJWT(tt.token, testSecret)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if claims.Sub != tt.wantSub || claims.Role != tt.wantRole {
+				t.Errorf("sub=%q role=%q, want sub=%q role=%q", claims.Sub, claims.Role, tt.wantSub, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestVerifyJWTTampered(t *testing.T) {
+	token := signJWT(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "viewer", "role": "viewer"}, testSecret)
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(map[string]interface{}{"sub": "viewer", "role": "admin"})
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	if _, err := verifyJWT(strings.Join(parts, "."), testSecret); err == nil {
+		t.Error("修改内容后签名应无效")
+	}
+}
+
+// 加载只包含API密钥的配置，测试结束后清空
+func setAPIKeys(t *testing.T, keys ...config.APIKey) {
+	t.Helper()
+	load := func(keys []config.APIKey) {
+		data, err := json.Marshal(map[string][]config.APIKey{"api_keys": keys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.LoadConfig(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load(keys)
+	t.Cleanup(func() { load([]config.APIKey{}) })
+}
+
+func TestCheckAny(t *testing.T) {
+	setAPIKeys(t, config.APIKey{Name: "bot", Key: "good"})
+
+	tests := []struct {
+		name        string
+		credentials []string
+		wantName    string
+		wantErr     bool
+	}{
+		{"认证包中的key", []string{"good", ""}, "bot", false},
+		{"认证包中是B站的token时使用请求中的凭证", []string{"bilibili-token", "good"}, "bot", false},
+		{"没有认证包key时使用请求中的凭证", []string{"", "good"}, "bot", false},
+		{"都无效", []string{"bilibili-token", "bad"}, "", true},
+		{"都为空", []string{"", ""}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := DenialCounts()
+			id, err := CheckAny(tt.credentials...)
+			after, _ := DenialCounts()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if after-before != 1 {
+					t.Errorf("认证失败计数增加了 %d, want 1", after-before)
+				}
+				return
+			}
+			if id.Name != tt.wantName {
+				t.Errorf("Name = %q, want %q", id.Name, tt.wantName)
+			}
+			if after != before {
+				t.Error("认证成功不应计入失败次数")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/FH-TianHe/BiliMux/config"
+)
+
+var originRejected int64 // 来源不允许的请求数
+
+// 检查请求的Origin是否在允许列表中。没有Origin头的非浏览器客户端总是允许，
+// 列表为空时不限制。
+func CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || originAllowed(origin, config.GetConfig().AllowedOrigins) {
+		return true
+	}
+	log.Printf("拒绝来源: %s %s (Origin: %s)", r.RemoteAddr, r.URL.Path, origin)
+	atomic.AddInt64(&originRejected, 1)
+	return false
+}
+
+// 因来源不在允许列表中被拒绝的请求数
+func OriginRejections() int64 {
+	return atomic.LoadInt64(&originRejected)
+}
+
+// 规则可以是完整的来源(https://example.com)，也可以省略协议只匹配主机名，
+// *匹配任意不含/的字符，单独的*匹配所有来源
+func originAllowed(origin string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	host := origin
+	if u, err := url.Parse(origin); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSuffix(p, "/"))
+		if p == "*" {
+			return true
+		}
+		target := origin
+		if !strings.Contains(p, "://") {
+			target = host
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 为HTTP接口设置CORS响应头并应答预检请求，不允许的来源返回403
+func CORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next(w, r)
+			return
+		}
+		if !CheckOrigin(r) {
+			http.Error(w, "不允许的来源", http.StatusForbidden)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, X-API-Key, Content-Type")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
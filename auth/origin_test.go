@@ -0,0 +1,39 @@
+package auth
+
+import "testing"
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		origin   string
+		patterns []string
+		want     bool
+	}{
+		{"没有规则", "https://evil.com", nil, true},
+		{"单独的*", "https://evil.com", []string{"*"}, true},
+		{"完整来源", "https://example.com", []string{"https://example.com"}, true},
+		{"规则末尾的/", "https://example.com", []string{"https://example.com/"}, true},
+		{"协议不同", "http://example.com", []string{"https://example.com"}, false},
+		{"省略协议", "http://example.com", []string{"example.com"}, true},
+		{"大小写不敏感", "https://Example.COM", []string{"EXAMPLE.com"}, true},
+		{"端口不同", "https://example.com:8443", []string{"example.com"}, false},
+		{"带端口的规则", "https://example.com:8443", []string{"example.com:8443"}, true},
+		{"子域名通配", "https://live.example.com", []string{"*.example.com"}, true},
+		{"通配不匹配根域名", "https://example.com", []string{"*.example.com"}, false},
+		{"通配不跨越点以外的部分", "https://example.com.evil.com", []string{"*.example.com"}, false},
+		{"后缀相同的其他域名", "https://notexample.com", []string{"example.com"}, false},
+		{"带协议的通配", "https://a.example.com", []string{"https://*.example.com"}, true},
+		{"带协议的通配协议不同", "http://a.example.com", []string{"https://*.example.com"}, false},
+		{"端口通配", "http://localhost:3000", []string{"localhost:*"}, true},
+		{"多个规则", "https://b.com", []string{"a.com", "b.com"}, true},
+		{"都不匹配", "https://c.com", []string{"a.com", "b.com"}, false},
+		{"null来源", "null", []string{"example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := originAllowed(tt.origin, tt.patterns); got != tt.want {
+				t.Errorf("originAllowed(%q, %q) = %v, want %v", tt.origin, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
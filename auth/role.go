@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 管理权限，高级角色拥有低级角色的全部权限
+type Role int
+
+const (
+	RoleNone     Role = iota // 只能订阅房间
+	RoleViewer               // 查看统计和租户用量
+	RoleOperator             // 扫码登录、断开客户端等日常操作
+	RoleAdmin                // 全部操作
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// 解析配置文件或JWT中的角色名，无法识别时返回RoleNone
+func ParseRole(name string) Role {
+	for role, n := range roleNames {
+		if n == name {
+			return role
+		}
+	}
+	return RoleNone
+}
+
+// 角色名是否有效，空字符串视为有效
+func ValidRole(name string) bool {
+	for _, n := range roleNames {
+		if n == name {
+			return true
+		}
+	}
+	return name == ""
+}
+
+// 被拒绝的请求
+type Denial struct {
+	Time     time.Time `json:"time"`
+	Identity string    `json:"identity"`
+	Role     string    `json:"role"`     // 调用方的角色
+	Required string    `json:"required"` // 操作需要的角色
+	Action   string    `json:"action"`   // 请求路径或gRPC方法
+	Remote   string    `json:"remote"`
+}
+
+// 保留的最近拒绝记录数
+const maxDenials = 100
+
+var (
+	unauthorized int64 // 认证失败次数
+	forbidden    int64 // 权限不足次数
+
+	denialsMu sync.Mutex
+	denials   []Denial
+)
+
+// 检查身份是否拥有所需角色，不满足时记录并返回false
+func Authorize(id *Identity, required Role, action, remote string) bool {
+	if id.Role >= required {
+		return true
+	}
+	log.Printf("权限不足: %s (%s) 需要 %s 才能访问 %s，来自 %s", id.Name, id.Role, required, action, remote)
+	atomic.AddInt64(&forbidden, 1)
+
+	denialsMu.Lock()
+	defer denialsMu.Unlock()
+	denials = append(denials, Denial{
+		Time:     time.Now(),
+		Identity: id.Name,
+		Role:     id.Role.String(),
+		Required: required.String(),
+		Action:   action,
+		Remote:   remote,
+	})
+	if len(denials) > maxDenials {
+		denials = denials[len(denials)-maxDenials:]
+	}
+	return false
+}
+
+// 要求请求通过认证且拥有指定角色
+func RequireRole(required Role, next http.HandlerFunc) http.HandlerFunc {
+	return Require(func(w http.ResponseWriter, r *http.Request) {
+		if !Authorize(FromContext(r.Context()), required, r.URL.Path, r.RemoteAddr) {
+			http.Error(w, "权限不足", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// 认证失败和权限不足的次数
+func DenialCounts() (unauthorizedCount, forbiddenCount int64) {
+	return atomic.LoadInt64(&unauthorized), atomic.LoadInt64(&forbidden)
+}
+
+// 最近被拒绝的请求，按时间先后排列
+func Denials() []Denial {
+	denialsMu.Lock()
+	defer denialsMu.Unlock()
+	return append([]Denial(nil), denials...)
+}
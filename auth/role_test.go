@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  Role
+		valid bool
+	}{
+		{"", RoleNone, true},
+		{"none", RoleNone, true},
+		{"viewer", RoleViewer, true},
+		{"operator", RoleOperator, true},
+		{"admin", RoleAdmin, true},
+		{"Admin", RoleNone, false},
+		{"root", RoleNone, false},
+	}
+	for _, tt := range tests {
+		if got := ParseRole(tt.name); got != tt.want {
+			t.Errorf("ParseRole(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := ValidRole(tt.name); got != tt.valid {
+			t.Errorf("ValidRole(%q) = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
+
+func TestAuthorizeWithoutAuth(t *testing.T) {
+	// 测试中没有加载配置，认证处于关闭状态
+	if Enabled() {
+		t.Fatal("认证不应开启")
+	}
+	id, err := Check("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		id       *Identity
+		required Role
+		want     bool
+	}{
+		{"匿名可以订阅", id, RoleNone, true},
+		{"匿名可以查看统计", id, RoleViewer, true},
+		{"匿名不能执行日常操作", id, RoleOperator, false},
+		{"匿名不能执行管理操作", id, RoleAdmin, false},
+		{"未经认证的请求只能订阅", FromContext(context.Background()), RoleNone, true},
+		{"未经认证的请求不能查看统计", FromContext(context.Background()), RoleViewer, false},
+		{"context中的身份", FromContext(WithIdentity(context.Background(), &Identity{Name: "ops", Role: RoleOperator})), RoleOperator, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Authorize(tt.id, tt.required, "/test", "127.0.0.1"); got != tt.want {
+				t.Errorf("Authorize(%s, %s) = %v, want %v", tt.id.Role, tt.required, got, tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,37 @@ type Config struct {
 	Buvid3 string `json:"buvid3"`
 	Buvid4 string `json:"buvid4"`
 	BNut   string `json:"b_nut"`
+
+	// 访问控制，两者都为空时不要求认证
+	APIKeys   []APIKey `json:"api_keys,omitempty"`
+	JWTSecret string   `json:"jwt_secret,omitempty"` // HS256签名密钥
+
+	// 允许的浏览器来源，支持通配符，如https://*.example.com，为空时不限制
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+
+	// 直播间限制，房间号可以是短号或真实房间ID
+	AllowedRooms      []int `json:"allowed_rooms,omitempty"`        // 为空时不限制
+	DeniedRooms       []int `json:"denied_rooms,omitempty"`         // 优先于允许列表
+	MaxClientsPerRoom int   `json:"max_clients_per_room,omitempty"` // 0表示不限制
+
+	// 租户，每个租户使用自己的API密钥并有独立的配额
+	Tenants []Tenant `json:"tenants,omitempty"`
+}
+
+// 租户及其配额，配额为0表示不限制
+type Tenant struct {
+	Name          string `json:"name"`
+	Key           string `json:"key"`                      // API密钥
+	MaxRooms      int    `json:"max_rooms,omitempty"`      // 同时订阅的房间数
+	MaxConns      int    `json:"max_conns,omitempty"`      // 并发连接数
+	MessageBudget int64  `json:"message_budget,omitempty"` // 每月可转发的消息数
+}
+
+// API密钥
+type APIKey struct {
+	Name string `json:"name"` // 身份名称，用于日志和统计
+	Key  string `json:"key"`
+	Role string `json:"role,omitempty"` // viewer、operator或admin，为空时只能订阅
 }
 
 var (
@@ -0,0 +1,58 @@
+package event
+
+import "sync"
+
+// 同一帧B站数据产生的一批事件。原样转发时同一房间的客户端共享编码结果，
+// 每种压缩版本只压缩一次
+type Batch struct {
+	events []*Event
+
+	mu     sync.Mutex
+	frames map[uint16][]byte // 压缩版本 -> 数据帧
+}
+
+// 将事件归为一批。frame不为nil时为B站发来的原始数据帧，
+// 压缩版本为version的客户端直接收到该帧
+func NewBatch(events []*Event, version uint16, frame []byte) *Batch {
+	b := &Batch{events: events, frames: make(map[uint16][]byte)}
+	if frame != nil {
+		b.frames[version] = frame
+	}
+	for _, ev := range events {
+		ev.batch = b
+	}
+	return b
+}
+
+// 事件所属的批次，补发的历史弹幕和通知事件返回nil
+func (ev *Event) Batch() *Batch {
+	return ev.batch
+}
+
+// events是否恰好是整批事件，过滤掉部分事件后不能共享编码结果
+func (b *Batch) Whole(events []*Event) bool {
+	if len(events) != len(b.events) {
+		return false
+	}
+	for _, ev := range events {
+		if ev.batch != b {
+			return false
+		}
+	}
+	return true
+}
+
+// 按压缩版本取数据帧，没有缓存时调用encode生成并缓存
+func (b *Batch) Frame(version uint16, encode func() ([]byte, error)) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if frame, ok := b.frames[version]; ok {
+		return frame, nil
+	}
+	frame, err := encode()
+	if err != nil {
+		return nil, err
+	}
+	b.frames[version] = frame
+	return frame, nil
+}
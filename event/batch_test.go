@@ -0,0 +1,56 @@
+package event
+
+import "testing"
+
+func TestBatchWhole(t *testing.T) {
+	a, b, c := &Event{Seq: 1}, &Event{Seq: 2}, &Event{Seq: 3}
+	batch := NewBatch([]*Event{a, b}, 0, nil)
+	other := &Event{Seq: 2}
+
+	tests := []struct {
+		name   string
+		events []*Event
+		want   bool
+	}{
+		{"整批", []*Event{a, b}, true},
+		{"过滤掉一部分", []*Event{a}, false},
+		{"不属于任何批次", []*Event{a, c}, false},
+		{"长度相同但事件不同", []*Event{a, other}, false},
+	}
+	for _, tt := range tests {
+		if got := batch.Whole(tt.events); got != tt.want {
+			t.Errorf("%s: Whole = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if c.Batch() != nil {
+		t.Error("未归批的事件Batch应为nil")
+	}
+}
+
+func TestBatchFrame(t *testing.T) {
+	upstream := []byte("upstream")
+	batch := NewBatch([]*Event{{Seq: 1}}, 3, upstream)
+
+	calls := 0
+	encode := func() ([]byte, error) {
+		calls++
+		return []byte("zlib"), nil
+	}
+	for i := 0; i < 3; i++ {
+		got, err := batch.Frame(2, encode)
+		if err != nil || string(got) != "zlib" {
+			t.Fatalf("Frame(2) = %q, %v", got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("encode调用了 %d 次, want 1", calls)
+	}
+
+	got, err := batch.Frame(3, func() ([]byte, error) {
+		t.Error("原始帧的版本不应重新编码")
+		return nil, nil
+	})
+	if err != nil || string(got) != "upstream" {
+		t.Errorf("Frame(3) = %q, %v, want upstream", got, err)
+	}
+}
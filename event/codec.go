@@ -0,0 +1,143 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 输出格式，取值即WebSocket子协议名
+type Format string
+
+const (
+	FormatRaw     Format = "bilibili.raw" // 原样转发B站数据包
+	FormatJSON    Format = "bilimux.json"
+	FormatMsgpack Format = "bilimux.msgpack"
+	FormatCBOR    Format = "bilimux.cbor"
+)
+
+// 支持协商的子协议，按服务端优先级排列
+var Subprotocols = []string{
+	string(FormatJSON),
+	string(FormatMsgpack),
+	string(FormatCBOR),
+	string(FormatRaw),
+}
+
+// 由协商结果得到输出格式，未协商子协议时保持原样转发
+func ParseFormat(subprotocol string) Format {
+	switch f := Format(subprotocol); f {
+	case FormatJSON, FormatMsgpack, FormatCBOR:
+		return f
+	}
+	return FormatRaw
+}
+
+// 是否输出解码后的事件
+func (f Format) Decoded() bool {
+	return f != FormatRaw
+}
+
+// 对应的WebSocket消息类型
+func (f Format) MessageType() int {
+	if f == FormatJSON {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+// 按输出格式编码，v可以是单个事件或事件数组
+func Encode(f Format, v interface{}) ([]byte, error) {
+	switch f {
+	case FormatJSON:
+		return json.Marshal(v)
+	case FormatMsgpack:
+		v, err := binaryValue(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		enc.UseCompactInts(true)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatCBOR:
+		v, err := binaryValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return cbor.Marshal(v)
+	}
+	return nil, fmt.Errorf("不支持的输出格式: %s", f)
+}
+
+// 二进制格式无法直接嵌入原始JSON，需要先把Data展开为通用结构
+func binaryValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case *Event:
+		return expandData(v)
+	case []*Event:
+		out := make([]*Event, len(v))
+		for i, ev := range v {
+			expanded, err := expandData(ev)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = expanded
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func expandData(ev *Event) (*Event, error) {
+	raw, ok := ev.Data.(json.RawMessage)
+	if !ok {
+		return ev, nil
+	}
+	copied := *ev
+	data, err := decodeGeneric(raw)
+	if err != nil {
+		return nil, err
+	}
+	copied.Data = data
+	return &copied, nil
+}
+
+// 解析JSON为通用结构，整数保持为int64以免UID等字段丢失精度
+func decodeGeneric(raw json.RawMessage) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return convertNumbers(v), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// 原样转发时历史弹幕使用的cmd，B站客户端会忽略未知的cmd
+const BackfillCmd = "BILIMUX_BACKFILL"
+
+// 解码后下发给客户端的事件，各种输出格式共用同一结构
+type Event struct {
+	Seq        uint64      `json:"seq,omitempty"` // 房间内单调递增的序号
+	Cmd        string      `json:"cmd"`
+	RoomID     int         `json:"room_id,omitempty"`
+	Time       int64       `json:"ts"` // 收到消息的时间(毫秒)
+	UID        int64       `json:"uid,omitempty"`
+	Uname      string      `json:"uname,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	GiftValue  int64       `json:"gift_value,omitempty"`
+	GuardLevel int         `json:"guard_level,omitempty"`
+	Backfill   bool        `json:"backfill,omitempty"` // 是否为加入时补发的历史弹幕
+	Data       interface{} `json:"data"`               // 原始消息内容
+
+	msg   *protocol.Message
+	batch *Batch
+}
+
+// 由业务消息构造事件
+func FromMessage(roomID int, msg *protocol.Message) *Event {
+	return &Event{
+		Cmd:        msg.Cmd,
+		RoomID:     roomID,
+		Time:       time.Now().UnixMilli(),
+		UID:        msg.UID,
+		Uname:      msg.Uname,
+		Text:       msg.Text,
+		GiftValue:  msg.GiftValue,
+		GuardLevel: msg.GuardLevel,
+		Data:       msg.Raw,
+		msg:        msg,
+	}
+}
+
+// 构造历史弹幕事件，时间为弹幕的发送时间
+func History(roomID int, msg *protocol.Message, sentAt time.Time) *Event {
+	ev := FromMessage(roomID, msg)
+	ev.Time = sentAt.UnixMilli()
+	ev.Backfill = true
+	return ev
+}
+
+// 构造BiliMux自身产生的通知事件，如跳过汇总和断档标记
+func Notice(roomID int, cmd string, data interface{}) *Event {
+	return &Event{
+		Cmd:    cmd,
+		RoomID: roomID,
+		Time:   time.Now().UnixMilli(),
+		Data:   data,
+	}
+}
+
+// 对应的业务消息，通知事件返回nil
+func (ev *Event) Message() *protocol.Message {
+	return ev.msg
+}
+
+// 原始消息内容的字节数，通知事件为0
+func (ev *Event) RawSize() int {
+	if ev.msg == nil {
+		return 0
+	}
+	return len(ev.msg.Raw)
+}
+
+// 原样转发时使用的消息包内容：B站消息保持原始JSON，通知事件和历史弹幕按B站格式封装
+func (ev *Event) Body() ([]byte, error) {
+	if ev.Backfill {
+		return json.Marshal(map[string]interface{}{
+			"cmd":  BackfillCmd,
+			"data": ev.Data,
+		})
+	}
+	if raw, ok := ev.Data.(json.RawMessage); ok {
+		return raw, nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"cmd":  ev.Cmd,
+		"data": ev.Data,
+	})
+}
@@ -0,0 +1,181 @@
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// 客户端消息过滤规则
+//
+// 每个条件只约束携带对应字段的消息：关键词/正则只作用于弹幕和醒目留言，
+// 最低礼物价值只作用于礼物类消息，UID和舰长等级只作用于带有发送者的消息。
+type Filter struct {
+	Cmds          []string `json:"cmds,omitempty"`            // 命令白名单
+	ExcludeCmds   []string `json:"exclude_cmds,omitempty"`    // 命令黑名单
+	Keywords      []string `json:"keywords,omitempty"`        // 文本需包含任一关键词
+	Regex         string   `json:"regex,omitempty"`           // 文本需匹配的正则
+	UIDs          []int64  `json:"uids,omitempty"`            // 发送者UID白名单
+	ExcludeUIDs   []int64  `json:"exclude_uids,omitempty"`    // 发送者UID黑名单
+	MinGiftValue  int64    `json:"min_gift_value,omitempty"`  // 最低礼物价值(金瓜子)
+	MinGuardLevel int      `json:"min_guard_level,omitempty"` // 最低舰长等级: 1总督 2提督 3舰长
+
+	cmds        map[string]bool
+	excludeCmds map[string]bool
+	uids        map[int64]bool
+	excludeUIDs map[int64]bool
+	re          *regexp.Regexp
+}
+
+// 编译过滤规则，修改字段后需要重新调用
+func (f *Filter) Compile() error {
+	f.cmds = stringSet(f.Cmds)
+	f.excludeCmds = stringSet(f.ExcludeCmds)
+	f.uids = int64Set(f.UIDs)
+	f.excludeUIDs = int64Set(f.ExcludeUIDs)
+
+	f.re = nil
+	if f.Regex != "" {
+		re, err := regexp.Compile(f.Regex)
+		if err != nil {
+			return fmt.Errorf("无效的正则表达式: %v", err)
+		}
+		f.re = re
+	}
+
+	if f.MinGuardLevel < 0 || f.MinGuardLevel > protocol.GuardCaptain {
+		return fmt.Errorf("无效的舰长等级: %d", f.MinGuardLevel)
+	}
+	return nil
+}
+
+// 是否没有任何条件
+func (f *Filter) Empty() bool {
+	return len(f.Cmds) == 0 && len(f.ExcludeCmds) == 0 && len(f.Keywords) == 0 &&
+		f.Regex == "" && len(f.UIDs) == 0 && len(f.ExcludeUIDs) == 0 &&
+		f.MinGiftValue == 0 && f.MinGuardLevel == 0
+}
+
+// 判断消息是否应该发送给客户端
+func (f *Filter) Match(msg *protocol.Message) bool {
+	if len(f.cmds) > 0 && !f.cmds[msg.Cmd] {
+		return false
+	}
+	if f.excludeCmds[msg.Cmd] {
+		return false
+	}
+
+	if msg.HasText() {
+		if len(f.Keywords) > 0 && !containsAny(msg.Text, f.Keywords) {
+			return false
+		}
+		if f.re != nil && !f.re.MatchString(msg.Text) {
+			return false
+		}
+	}
+
+	if msg.UID != 0 {
+		if len(f.uids) > 0 && !f.uids[msg.UID] {
+			return false
+		}
+		if f.excludeUIDs[msg.UID] {
+			return false
+		}
+		if f.MinGuardLevel > 0 && (msg.GuardLevel == protocol.GuardNone || msg.GuardLevel > f.MinGuardLevel) {
+			return false
+		}
+	}
+
+	if msg.IsGift() && msg.GiftValue < f.MinGiftValue {
+		return false
+	}
+
+	return true
+}
+
+// 从URL参数解析过滤规则，没有任何条件时返回nil
+func FromQuery(query url.Values) (*Filter, error) {
+	f := &Filter{
+		Cmds:        splitList(query.Get("cmds")),
+		ExcludeCmds: splitList(query.Get("exclude_cmds")),
+		Keywords:    splitList(query.Get("keywords")),
+		Regex:       query.Get("regex"),
+	}
+
+	var err error
+	if f.UIDs, err = parseInt64List(query.Get("uids")); err != nil {
+		return nil, err
+	}
+	if f.ExcludeUIDs, err = parseInt64List(query.Get("exclude_uids")); err != nil {
+		return nil, err
+	}
+	if v := query.Get("min_gift_value"); v != "" {
+		if f.MinGiftValue, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("无效的min_gift_value: %s", v)
+		}
+	}
+	if v := query.Get("min_guard_level"); v != "" {
+		if f.MinGuardLevel, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("无效的min_guard_level: %s", v)
+		}
+	}
+
+	if f.Empty() {
+		return nil, nil
+	}
+	if err := f.Compile(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseInt64List(s string) ([]int64, error) {
+	var list []int64
+	for _, item := range splitList(s) {
+		v, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的UID: %s", item)
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func stringSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, item := range list {
+		set[item] = true
+	}
+	return set
+}
+
+func int64Set(list []int64) map[int64]bool {
+	set := make(map[int64]bool, len(list))
+	for _, item := range list {
+		set[item] = true
+	}
+	return set
+}
+
+func containsAny(text string, keywords []string) bool {
+	for _, kw := range keywords {
+		if strings.Contains(text, kw) {
+			return true
+		}
+	}
+	return false
+}
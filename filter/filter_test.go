@@ -0,0 +1,126 @@
+package filter
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+func TestFromQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    *Filter
+		wantErr bool
+	}{
+		{"没有条件", "room_id=1", nil, false},
+		{"空列表", "cmds=,%20,&uids=", nil, false},
+		{
+			"列表去掉空白",
+			"cmds=DANMU_MSG,%20SEND_GIFT%20,&exclude_cmds=INTERACT_WORD&keywords=a,b",
+			&Filter{Cmds: []string{"DANMU_MSG", "SEND_GIFT"}, ExcludeCmds: []string{"INTERACT_WORD"}, Keywords: []string{"a", "b"}},
+			false,
+		},
+		{
+			"数值条件",
+			"uids=1,-2&exclude_uids=3&min_gift_value=1000&min_guard_level=3&regex=%5E%E6%B5%8B",
+			&Filter{UIDs: []int64{1, -2}, ExcludeUIDs: []int64{3}, MinGiftValue: 1000, MinGuardLevel: 3, Regex: "^测"},
+			false,
+		},
+		{"无效的UID", "uids=1,abc", nil, true},
+		{"无效的排除UID", "exclude_uids=1.5", nil, true},
+		{"无效的礼物价值", "min_gift_value=10yuan", nil, true},
+		{"无效的舰长等级", "min_guard_level=x", nil, true},
+		{"舰长等级超出范围", "min_guard_level=4", nil, true},
+		{"负的舰长等级", "min_guard_level=-1", nil, true},
+		{"无效的正则", "regex=(", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := FromQuery(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("got %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("got nil")
+			}
+			if !reflect.DeepEqual(got.Cmds, tt.want.Cmds) || !reflect.DeepEqual(got.ExcludeCmds, tt.want.ExcludeCmds) ||
+				!reflect.DeepEqual(got.Keywords, tt.want.Keywords) || got.Regex != tt.want.Regex ||
+				!reflect.DeepEqual(got.UIDs, tt.want.UIDs) || !reflect.DeepEqual(got.ExcludeUIDs, tt.want.ExcludeUIDs) ||
+				got.MinGiftValue != tt.want.MinGiftValue || got.MinGuardLevel != tt.want.MinGuardLevel {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func parse(t *testing.T, body string) *protocol.Message {
+	t.Helper()
+	msg, err := protocol.ParseMessage([]byte(body))
+	if err != nil {
+		t.Fatalf("解析消息失败: %v", err)
+	}
+	return msg
+}
+
+func TestMatch(t *testing.T) {
+	// 带协议后缀的弹幕，发送者UID 100，舰长
+	danmu := `{"cmd":"DANMU_MSG:4:0:2:2:2:0","info":[[],"你好 世界",[100,"用户"],[],[],[],[],3]}`
+	gift := `{"cmd":"SEND_GIFT","data":{"uid":200,"uname":"送礼","coin_type":"gold","total_coin":500}}`
+	silver := `{"cmd":"SEND_GIFT","data":{"uid":200,"uname":"送礼","coin_type":"silver","total_coin":5000}}`
+	online := `{"cmd":"ONLINE_RANK_COUNT","data":{"count":10}}`
+
+	tests := []struct {
+		name   string
+		filter Filter
+		body   string
+		want   bool
+	}{
+		{"空规则", Filter{}, danmu, true},
+		{"命令白名单去掉后缀", Filter{Cmds: []string{"DANMU_MSG"}}, danmu, true},
+		{"不在命令白名单", Filter{Cmds: []string{"SEND_GIFT"}}, danmu, false},
+		{"命令黑名单", Filter{ExcludeCmds: []string{"DANMU_MSG"}}, danmu, false},
+		{"包含关键词", Filter{Keywords: []string{"不存在", "世界"}}, danmu, true},
+		{"不含关键词", Filter{Keywords: []string{"再见"}}, danmu, false},
+		{"关键词不约束礼物", Filter{Keywords: []string{"再见"}}, gift, true},
+		{"匹配正则", Filter{Regex: "^你好"}, danmu, true},
+		{"不匹配正则", Filter{Regex: "^世界"}, danmu, false},
+		{"UID白名单", Filter{UIDs: []int64{100}}, danmu, true},
+		{"不在UID白名单", Filter{UIDs: []int64{1}}, danmu, false},
+		{"UID白名单不约束没有发送者的消息", Filter{UIDs: []int64{1}}, online, true},
+		{"UID黑名单", Filter{ExcludeUIDs: []int64{100}}, danmu, false},
+		{"舰长满足舰长要求", Filter{MinGuardLevel: protocol.GuardCaptain}, danmu, true},
+		{"舰长不满足总督要求", Filter{MinGuardLevel: protocol.GuardGovernor}, danmu, false},
+		{"非舰长不满足舰长要求", Filter{MinGuardLevel: protocol.GuardCaptain}, gift, false},
+		{"礼物价值足够", Filter{MinGiftValue: 500}, gift, true},
+		{"礼物价值不足", Filter{MinGiftValue: 501}, gift, false},
+		{"银瓜子礼物没有价值", Filter{MinGiftValue: 1}, silver, false},
+		{"礼物价值不约束弹幕", Filter{MinGiftValue: 1000}, danmu, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.filter
+			if err := f.Compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Match(parse(t, tt.body)); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
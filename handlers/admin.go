@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/FH-TianHe/BiliMux/auth"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/tenant"
+)
+
+// 租户配额和用量，可用month=2006-01只查看某个月
+func TenantsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tenant.List(r.URL.Query().Get("month")))
+	}
+}
+
+// 认证失败和权限不足的次数，以及最近被拒绝的请求
+func DenialsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		unauthorized, forbidden := auth.DenialCounts()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"unauthorized": unauthorized,
+			"forbidden":    forbidden,
+			"recent":       auth.Denials(),
+		})
+	}
+}
+
+// 当前连接的客户端，按连接先后排列
+func AdminClientsHandler(cm *manager.ConnectionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clients := cm.ClientStats()
+		sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(clients)
+	}
+}
+
+// 当前与B站的连接，包括服务器地址、状态和最近一次心跳回复的时间
+func AdminUpstreamsHandler(rooms *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		infos := []hub.RoomInfo{}
+		for _, room := range rooms.Rooms() {
+			infos = append(infos, room.Info())
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+	}
+}
+
+// 断开指定id的客户端
+func DisconnectClientHandler(cm *manager.ConnectionManager) http.HandlerFunc {
+	return adminAction(func(r *http.Request) (string, error) {
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			return "", &adminError{http.StatusBadRequest, "无效的id参数"}
+		}
+		if !cm.Disconnect(id) {
+			return "", &adminError{http.StatusNotFound, "客户端不存在"}
+		}
+		return fmt.Sprintf("断开客户端 %d", id), nil
+	})
+}
+
+// 断开房间的B站连接并立即重连
+func ReconnectUpstreamHandler(rooms *hub.Hub) http.HandlerFunc {
+	return adminAction(func(r *http.Request) (string, error) {
+		room, err := adminRoom(rooms, r)
+		if err != nil {
+			return "", err
+		}
+		if !room.Reconnect() {
+			return "", &adminError{http.StatusConflict, "房间正在重连"}
+		}
+		return fmt.Sprintf("重连房间 %d", room.ID), nil
+	})
+}
+
+// 重新获取buvid3和token后重连房间
+func RefreshUpstreamHandler(rooms *hub.Hub) http.HandlerFunc {
+	return adminAction(func(r *http.Request) (string, error) {
+		room, err := adminRoom(rooms, r)
+		if err != nil {
+			return "", err
+		}
+		if err := rooms.RefreshToken(room.ID); err != nil {
+			return "", &adminError{http.StatusBadGateway, err.Error()}
+		}
+		return fmt.Sprintf("刷新房间 %d 的token", room.ID), nil
+	})
+}
+
+// 关闭房间并断开其所有客户端
+func CloseRoomHandler(rooms *hub.Hub) http.HandlerFunc {
+	return adminAction(func(r *http.Request) (string, error) {
+		room, err := adminRoom(rooms, r)
+		if err != nil {
+			return "", err
+		}
+		if !rooms.CloseRoom(room.ID) {
+			return "", &adminError{http.StatusNotFound, "房间未打开"}
+		}
+		return fmt.Sprintf("关闭房间 %d", room.ID), nil
+	})
+}
+
+// 管理操作失败的原因和HTTP状态码
+type adminError struct {
+	status  int
+	message string
+}
+
+func (e *adminError) Error() string {
+	return e.message
+}
+
+// 管理操作只接受POST，成功后记录操作人并返回{"ok":true}
+func adminAction(action func(r *http.Request) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "只支持POST", http.StatusMethodNotAllowed)
+			return
+		}
+		desc, err := action(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if ae, ok := err.(*adminError); ok {
+				status = ae.status
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("管理操作: %s %s", auth.FromContext(r.Context()).Name, desc)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+	}
+}
+
+// 按room_id参数查找已打开的房间，room_id可以是短号
+func adminRoom(rooms *hub.Hub, r *http.Request) (*hub.Room, error) {
+	roomID, err := strconv.Atoi(r.URL.Query().Get("room_id"))
+	if err != nil || roomID <= 0 {
+		return nil, &adminError{http.StatusBadRequest, "无效的room_id参数"}
+	}
+	realRoomID, err := rooms.ResolveRoomID(roomID)
+	if err != nil {
+		return nil, &adminError{err.(*hub.Error).HTTPStatus(), err.Error()}
+	}
+	room, ok := rooms.Lookup(realRoomID)
+	if !ok {
+		return nil, &adminError{http.StatusNotFound, "房间未打开"}
+	}
+	return room, nil
+}
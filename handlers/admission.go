@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/limit"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/tenant"
+)
+
+// 被拒绝的HTTP请求建议的重试间隔(秒)
+const retryAfterSeconds = 5
+
+var (
+	admissionWait    time.Duration // 没有空闲名额时最多等待的时间，0表示直接拒绝
+	admissionQueue   = 0           // 同时等待名额的客户端数上限
+	admissionWaiting int32
+)
+
+// 设置连接数达到上限时的排队等待
+func SetAdmission(wait time.Duration, queue int) error {
+	if wait < 0 || queue < 0 {
+		return fmt.Errorf("等待时间和队列长度不能为负数")
+	}
+	admissionWait, admissionQueue = wait, queue
+	return nil
+}
+
+// 在建立任何B站连接之前申请连接名额，必要时在队列中等待
+func admit(ctx context.Context, cm *manager.ConnectionManager) bool {
+	if cm.TryAcquire() {
+		return true
+	}
+	if admissionWait <= 0 {
+		return false
+	}
+	if atomic.AddInt32(&admissionWaiting, 1) > int32(admissionQueue) {
+		atomic.AddInt32(&admissionWaiting, -1)
+		return false
+	}
+	defer atomic.AddInt32(&admissionWaiting, -1)
+
+	ctx, cancel := context.WithTimeout(ctx, admissionWait)
+	defer cancel()
+	return cm.Acquire(ctx)
+}
+
+// 检查单IP限制和全局连接数限制，都通过后返回释放单IP名额的函数。
+// 未通过时已向客户端回复拒绝原因。
+func admitClient(w http.ResponseWriter, r *http.Request, cm *manager.ConnectionManager) (func(), bool) {
+	ip := limit.ClientIP(r)
+	if err := limit.Open(ip); err != nil {
+		reject(w, r, cm, manager.RejectIP, http.StatusTooManyRequests, websocket.CloseTryAgainLater, err.Error())
+		return nil, false
+	}
+	if !admit(r.Context(), cm) {
+		limit.Close(ip)
+		reject(w, r, cm, manager.RejectLimit, http.StatusServiceUnavailable, websocket.CloseTryAgainLater, "达到最大连接数限制")
+		return nil, false
+	}
+	return func() { limit.Close(ip) }, true
+}
+
+// 占用租户的连接名额并订阅房间，返回释放函数
+func admitTenant(account *tenant.Account, realRoomID int) (func(), error) {
+	if err := account.Open(); err != nil {
+		return nil, err
+	}
+	if err := account.JoinRoom(realRoomID); err != nil {
+		account.Close()
+		return nil, err
+	}
+	return func() {
+		account.LeaveRoom(realRoomID)
+		account.Close()
+	}, nil
+}
+
+// 错误对应的关闭码和原因，房间和租户错误带有明确的错误码
+func errorCode(err error) (int, string) {
+	switch e := err.(type) {
+	case *hub.Error:
+		return e.Code, e.Message
+	case *tenant.QuotaError:
+		return tenant.CodeQuotaExceeded, e.Message
+	}
+	return websocket.CloseInternalServerErr, err.Error()
+}
+
+// 房间或租户错误对应的拒绝原因
+func rejectReason(err error) string {
+	if _, ok := err.(*tenant.QuotaError); ok {
+		return manager.RejectTenant
+	}
+	return manager.RejectRoom
+}
+
+// 按错误码拒绝客户端，HTTP状态码为错误码减去4000
+func rejectError(w http.ResponseWriter, r *http.Request, cm *manager.ConnectionManager, err error) {
+	code, reason := errorCode(err)
+	status := http.StatusInternalServerError
+	if code >= 4000 {
+		status = code - 4000
+	}
+	reject(w, r, cm, rejectReason(err), status, code, reason)
+}
+
+// 拒绝客户端：普通HTTP请求返回对应的状态码，
+// WebSocket客户端升级后以关闭码关闭，使浏览器也能拿到原因
+func reject(w http.ResponseWriter, r *http.Request, cm *manager.ConnectionManager, cause string, status, closeCode int, reason string) {
+	log.Printf("拒绝客户端: %s: %s", limit.ClientIP(r), reason)
+	cm.IncrementRejected(cause)
+
+	if !websocket.IsWebSocketUpgrade(r) {
+		if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+		}
+		http.Error(w, reason, status)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	msg := websocket.FormatCloseMessage(closeCode, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeTimeout))
+}
+
+// 以错误码关闭已建立的连接，TCP客户端没有关闭帧
+func (s *clientSession) closeWith(err error) {
+	code, reason := errorCode(err)
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+}
+
+// 在新的goroutine中发送关闭码后断开连接，重复调用时只断开一次。
+// 调用方可能持有房间的锁，关闭帧最多要等待writeTimeout，不能阻塞房间。
+func (s *clientSession) closeAsync(err error) {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return
+	}
+	go func() {
+		s.closeWith(err)
+		s.conn.Close()
+	}()
+}
+
+// 房间被关闭时由房间调用，发送关闭码后断开连接
+func (s *clientSession) Kick(err error) {
+	s.closeAsync(err)
+}
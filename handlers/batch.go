@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/event"
+)
+
+// 批量发送的默认参数
+const (
+	defaultBatchWait  = 50 * time.Millisecond
+	defaultBatchItems = 100
+	maxBatchWait      = 5 * time.Second
+)
+
+// 从URL参数解析批量发送设置，未指定batch_ms和batch_max时返回0表示不开启
+func parseBatchQuery(query url.Values) (time.Duration, int, error) {
+	msStr, maxStr := query.Get("batch_ms"), query.Get("batch_max")
+	if msStr == "" && maxStr == "" {
+		return 0, 0, nil
+	}
+
+	wait, items := defaultBatchWait, defaultBatchItems
+	if msStr != "" {
+		ms, err := strconv.Atoi(msStr)
+		if err != nil || ms <= 0 || time.Duration(ms)*time.Millisecond > maxBatchWait {
+			return 0, 0, fmt.Errorf("无效的batch_ms参数")
+		}
+		wait = time.Duration(ms) * time.Millisecond
+	}
+	if maxStr != "" {
+		n, err := strconv.Atoi(maxStr)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("无效的batch_max参数")
+		}
+		items = n
+	}
+	return wait, items, nil
+}
+
+// 将多条消息合并为一帧发送，最多等待maxWait或攒够maxItems个事件。
+// 入队在持有锁时进行，定时器和房间goroutine发送的批次不会乱序。
+type batcher struct {
+	s        *clientSession
+	maxWait  time.Duration
+	maxItems int
+
+	mu     sync.Mutex
+	events []*event.Event // 待发送的事件，原样转发时只用于计数
+	raw    []byte         // 原样转发时待发送的数据包
+	high   bool
+	timer  *time.Timer
+	gen    int // 批次序号，已发送批次的定时器不会发送下一批
+}
+
+func newBatcher(s *clientSession, maxWait time.Duration, maxItems int) *batcher {
+	return &batcher{s: s, maxWait: maxWait, maxItems: maxItems}
+}
+
+// 加入一个解码后的事件
+func (b *batcher) addEvent(ev *event.Event, high bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, ev)
+	return b.added(high)
+}
+
+// 加入一帧原样转发的数据包，多帧拼接后仍是合法的B站数据帧。
+// 一帧可能包含多个事件，按事件数计入maxItems。
+func (b *batcher) addRaw(data []byte, events []*event.Event, high bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.raw = append(b.raw, data...)
+	b.events = append(b.events, events...)
+	return b.added(high)
+}
+
+// 调用时需持有锁
+func (b *batcher) added(high bool) error {
+	b.high = b.high || high
+	if len(b.events) < b.maxItems {
+		if b.timer == nil {
+			gen := b.gen
+			b.timer = time.AfterFunc(b.maxWait, func() {
+				if err := b.flushGen(gen); err != nil {
+					b.s.conn.Close()
+				}
+			})
+		}
+		return nil
+	}
+	return b.sendLocked()
+}
+
+// 定时器到期时发送第gen批，该批已因攒满而发送时不做任何事
+func (b *batcher) flushGen(gen int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.gen {
+		return nil
+	}
+	return b.sendLocked()
+}
+
+// 取出已攒下的消息并放入发送队列，调用时需持有锁
+func (b *batcher) sendLocked() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	events, raw, high := b.events, b.raw, b.high
+	b.events, b.raw, b.high = nil, nil, false
+	b.gen++
+	return b.send(events, raw, high)
+}
+
+func (b *batcher) send(events []*event.Event, raw []byte, high bool) error {
+	if len(raw) > 0 {
+		return b.s.writeEvents(websocket.BinaryMessage, raw, events, high)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	data, err := event.Encode(b.s.format, events)
+	if err != nil {
+		log.Printf("编码事件失败: %v", err)
+		b.s.cm.IncrementClientErrors(b.s.client)
+		b.s.account.Refund(len(events))
+		return nil
+	}
+	return b.s.writeEvents(b.s.format.MessageType(), data, events, high)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/flate"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/manager"
+)
+
+var (
+	compressLevel   = 0   // permessage-deflate压缩级别，0表示不开启
+	compressMinSize = 256 // 小于该字节数的消息不压缩
+)
+
+// 设置发往客户端的permessage-deflate压缩
+func SetCompression(level, minSize int) error {
+	if level < 0 || level > flate.BestCompression {
+		return fmt.Errorf("压缩级别必须在0到%d之间", flate.BestCompression)
+	}
+	if minSize < 0 {
+		return fmt.Errorf("最小压缩字节数不能为负数")
+	}
+	compressLevel, compressMinSize = level, minSize
+	upgrader.EnableCompression = level > 0
+	return nil
+}
+
+// 客户端单条消息的最大长度，客户端只发送认证包、心跳包和控制消息
+const maxClientMessageSize = 64 << 10
+
+// 升级客户端连接，并统计实际写入网络的字节数(压缩后)
+func upgradeClient(w http.ResponseWriter, r *http.Request, cm *manager.ConnectionManager, client *manager.Client) (*websocket.Conn, error) {
+	conn, err := upgrader.Upgrade(&countingResponseWriter{ResponseWriter: w, cm: cm, client: client}, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(maxClientMessageSize)
+	if compressLevel > 0 {
+		conn.SetCompressionLevel(compressLevel)
+	}
+	return conn, nil
+}
+
+// 是否压缩该条消息
+func shouldCompress(data []byte) bool {
+	return compressLevel > 0 && len(data) >= compressMinSize
+}
+
+// 在连接被接管时包装底层连接以统计写入的字节数
+type countingResponseWriter struct {
+	http.ResponseWriter
+	cm     *manager.ConnectionManager
+	client *manager.Client
+}
+
+func (w *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("连接不支持接管")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingConn{Conn: conn, cm: w.cm, client: w.client}, rw, nil
+}
+
+type countingConn struct {
+	net.Conn
+	cm     *manager.ConnectionManager
+	client *manager.Client
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.cm.AddWireBytes(c.client, n)
+	return n, err
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 允许的最大延迟，延迟队列需要在内存中缓存这段时间内的事件
+var maxDelay = 5 * time.Minute
+
+// 设置允许的最大延迟
+func SetMaxDelay(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("最大延迟不能为负数")
+	}
+	maxDelay = d
+	return nil
+}
+
+// 解析延迟参数，如delay=30s，不带单位时按秒计算。
+// 按整秒取整，相近的延迟共用同一个延迟队列
+func parseDelay(query url.Values) (time.Duration, error) {
+	v := query.Get("delay")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		seconds, serr := strconv.ParseFloat(v, 64)
+		if serr != nil {
+			return 0, fmt.Errorf("无效的delay参数")
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	d = d.Round(time.Second)
+	if d < 0 || d > maxDelay {
+		return 0, fmt.Errorf("delay参数必须在0到%v之间", maxDelay)
+	}
+	return d, nil
+}
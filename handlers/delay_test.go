@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseDelay(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"delay=30s", 30 * time.Second, false},
+		{"delay=30", 30 * time.Second, false},
+		{"delay=1.000001", time.Second, false},
+		{"delay=1.000002", time.Second, false},
+		{"delay=1.6", 2 * time.Second, false},
+		{"delay=1500ms", 2 * time.Second, false},
+		{"delay=0.4", 0, false},
+		{"delay=5m", 5 * time.Minute, false},
+		{"delay=5m0.4s", 5 * time.Minute, false},
+		{"delay=6m", 0, true},
+		{"delay=-1", 0, true},
+		{"delay=abc", 0, true},
+	}
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseDelay(query)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/auth"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/limit"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/protocol"
+	"github.com/FH-TianHe/BiliMux/tenant"
+)
+
+// 等待客户端认证包的超时时间
+const authTimeout = 10 * time.Second
+
+// 认证失败时回复的错误码，与B站一致
+const authFailedCode = -101
+
+// 弹幕服务器模拟处理函数
+//
+// 客户端按B站弹幕服务器的协议连接，认证和心跳在本地应答，
+// 客户端发送的数据包不会转发给B站。
+func EmulateHandler(cm *manager.ConnectionManager, rooms *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 延迟参数在URL中指定，如/sub?delay=30s
+		delay, err := parseDelay(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 认证在收到认证包后进行，现有工具只改服务器地址即可使用认证包中的key
+		client := &manager.Client{
+			RemoteAddr:  limit.ClientIP(r),
+			ConnectedAt: time.Now(),
+		}
+
+		// 先检查连接数限制，被拒绝的客户端不会产生B站请求
+		release, ok := admitClient(w, r, cm)
+		if !ok {
+			return
+		}
+		defer release()
+
+		// 升级客户端连接到WebSocket
+		clientConn, err := upgradeClient(w, r, cm, client)
+		if err != nil {
+			log.Println("升级客户端连接失败:", err)
+			cm.IncrementClientErrors(client)
+			cm.Release()
+			return
+		}
+		defer clientConn.Close()
+
+		serveEmulated(clientConn, cm, rooms, client, delay, auth.Credential(r))
+	}
+}
+
+// 按B站弹幕服务器的协议服务已建立的客户端连接，WebSocket和TCP客户端共用。
+// 优先使用认证包中的key作为凭证，无效时使用credential(WebSocket请求头或查询参数中的凭证)。
+// 调用前需已申请到连接名额。
+func serveEmulated(conn sessionConn, cm *manager.ConnectionManager, rooms *hub.Hub, client *manager.Client, delay time.Duration, credential string) {
+	// 等待客户端认证包
+	body, err := readClientAuth(conn)
+	if err != nil {
+		log.Printf("读取客户端认证包失败: %s: %v", client.RemoteAddr, err)
+		cm.IncrementClientErrors(client)
+		cm.Release()
+		return
+	}
+
+	id, err := auth.CheckAny(body.Key, credential)
+	if err != nil {
+		log.Printf("认证失败: %s: %v", client.RemoteAddr, err)
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		conn.WriteMessage(websocket.BinaryMessage, authReplyPacket(authFailedCode))
+		cm.Release()
+		return
+	}
+	client.Identity, client.Tenant = id.Name, id.Tenant
+
+	// 不能订阅的房间或超出租户配额时在认证回复中返回错误码
+	account := tenant.Get(client.Tenant)
+	leave, err := admitEmulated(rooms, account, body.RoomID)
+	if err != nil {
+		log.Printf("拒绝客户端: %s: %v", client.RemoteAddr, err)
+		cm.IncrementRejected(rejectReason(err))
+		code, _ := errorCode(err)
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		conn.WriteMessage(websocket.BinaryMessage, authReplyPacket(code))
+		cm.Release()
+		return
+	}
+	defer leave()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 按客户端认证包中的protover压缩，兼容只支持zlib的旧客户端
+	client.RoomID = body.RoomID
+	session := newClientSession(cm, conn, client, nil, body.ProtoVer, defaultClientRate)
+	session.account = account
+
+	// 会话创建完成后再添加到连接管理器，统计接口读取时client已填写完整
+	cm.Register(conn, cancel, client)
+	defer cm.Remove(conn)
+
+	session.startLiveness()
+	go session.writeLoop(ctx)
+
+	// 认证回复需要排在所有消息之前，加入房间失败时直接断开
+	session.write(websocket.BinaryMessage, authReplyPacket(0))
+
+	// 模拟连接保持与B站一致，不补发历史弹幕
+	room, err := rooms.Join(body.RoomID, session, hub.JoinOptions{Since: -1, Delay: delay})
+	if err != nil {
+		log.Printf("加入房间 %d 失败: %v", body.RoomID, err)
+		cm.IncrementClientErrors(client)
+		session.closeWith(err)
+		return
+	}
+	defer rooms.Leave(room, session)
+
+	log.Printf("已建立模拟连接: %s (%s) <-> 房间 %d", client.RemoteAddr, client.Identity, room.ID)
+
+	session.readLoop(room)
+	log.Printf("模拟连接关闭: %s", client.RemoteAddr)
+}
+
+// 检查房间和租户配额
+func admitEmulated(rooms *hub.Hub, account *tenant.Account, roomID int) (func(), error) {
+	realRoomID, err := rooms.Check(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return admitTenant(account, realRoomID)
+}
+
+// 读取并校验客户端发送的认证包
+func readClientAuth(conn sessionConn) (*protocol.AuthBody, error) {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	header, body, err := parseClientPacket(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.Operation != protocol.OpAuth {
+		return nil, fmt.Errorf("首个数据包不是认证包")
+	}
+
+	var auth protocol.AuthBody
+	if err := json.Unmarshal(body, &auth); err != nil {
+		return nil, err
+	}
+	if auth.RoomID <= 0 {
+		return nil, fmt.Errorf("认证包中的房间ID无效")
+	}
+	return &auth, nil
+}
+
+// 解析客户端发送的数据包。客户端只发送认证包和心跳包，
+// 不接受压缩的包体，以免很小的数据包解压出大量内容
+func parseClientPacket(data []byte) (protocol.PacketHeader, []byte, error) {
+	header, body, err := protocol.ParseHeader(data)
+	if err != nil {
+		return protocol.PacketHeader{}, nil, err
+	}
+	if header.Version == protocol.VersionZlib || header.Version == protocol.VersionBrotli {
+		return protocol.PacketHeader{}, nil, fmt.Errorf("不接受压缩的客户端数据包")
+	}
+	return header, body, nil
+}
+
+// 认证回复包
+func authReplyPacket(code int) []byte {
+	body, _ := json.Marshal(map[string]int{"code": code})
+	return protocol.EncodePacket(protocol.OpAuthReply, 1, body)
+}
+
+// 心跳回复包，包体为4字节的人气值
+func heartbeatReplyPacket(popularity uint32) []byte {
+	body := make([]byte, 4)
+	binary.BigEndian.PutUint32(body, popularity)
+	return protocol.EncodePacket(protocol.OpHeartbeatReply, 1, body)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+func TestParseClientPacket(t *testing.T) {
+	heartbeat := protocol.EncodePacket(protocol.OpHeartbeat, 1, nil)
+	compress := func(version uint16) []byte {
+		data, err := protocol.CompressPackets(heartbeat, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantOp  uint32
+		wantErr bool
+	}{
+		{"心跳包", heartbeat, protocol.OpHeartbeat, false},
+		{"认证包", protocol.EncodePacket(protocol.OpAuth, 1, []byte(`{"roomid":1}`)), protocol.OpAuth, false},
+		{"未压缩的消息包", protocol.EncodePacket(protocol.OpMessage, protocol.VersionPlain, []byte("{}")), protocol.OpMessage, false},
+		{"zlib压缩", compress(protocol.VersionZlib), 0, true},
+		{"brotli压缩", compress(protocol.VersionBrotli), 0, true},
+		{"长度不足", heartbeat[:8], 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, _, err := parseClientPacket(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && header.Operation != tt.wantOp {
+				t.Errorf("Operation = %d, want %d", header.Operation, tt.wantOp)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/filter"
+)
+
+// 客户端通过文本帧发送的控制消息
+type controlMessage struct {
+	Type   string         `json:"type"`
+	Filter *filter.Filter `json:"filter,omitempty"`
+}
+
+// 控制消息的响应
+type controlReply struct {
+	Type    string `json:"type"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// 客户端当前生效的过滤规则，可以通过控制消息随时替换
+type clientFilter struct {
+	mu sync.RWMutex
+	f  *filter.Filter
+}
+
+func (c *clientFilter) Get() *filter.Filter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.f
+}
+
+func (c *clientFilter) Set(f *filter.Filter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.f = f
+}
+
+// 处理客户端控制消息
+func handleControl(data []byte, s *clientSession) error {
+	var msg controlMessage
+	reply := controlReply{OK: true}
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		reply.Type, reply.OK, reply.Message = "error", false, "无效的控制消息"
+	} else {
+		reply.Type = msg.Type
+		switch msg.Type {
+		case "filter":
+			if msg.Filter == nil || msg.Filter.Empty() {
+				s.filter.Set(nil)
+			} else if err := msg.Filter.Compile(); err != nil {
+				reply.OK, reply.Message = false, err.Error()
+			} else {
+				s.filter.Set(msg.Filter)
+			}
+		default:
+			reply.OK, reply.Message = false, "未知的控制消息类型"
+		}
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	return s.write(websocket.TextMessage, data)
+}
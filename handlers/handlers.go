@@ -6,34 +6,34 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"image"
 	"image/png"
 	"log"
-	"math/rand"
 	"net/http"
 	"net/url"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/skip2/go-qrcode"
 
-	"github.com/FH-TianHe/BiliMux/api"
-	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/auth"
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/filter"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/limit"
 	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/metrics"
 	"github.com/FH-TianHe/BiliMux/protocol"
+	"github.com/FH-TianHe/BiliMux/tenant"
 	"github.com/FH-TianHe/BiliMux/utils"
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin:  auth.CheckOrigin,
+	Subprotocols: event.Subprotocols,
 }
 
 // 代理处理函数
-func ProxyHandler(cm *manager.ConnectionManager) http.HandlerFunc {
+func ProxyHandler(cm *manager.ConnectionManager, rooms *hub.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 获取房间ID
 		roomIDStr := r.URL.Query().Get("room_id")
@@ -48,130 +48,151 @@ func ProxyHandler(cm *manager.ConnectionManager) http.HandlerFunc {
 			return
 		}
 
-		// 升级客户端连接到WebSocket
-		clientConn, err := upgrader.Upgrade(w, r, nil)
+		// 解析过滤规则
+		initialFilter, err := filter.FromQuery(r.URL.Query())
 		if err != nil {
-			log.Println("升级客户端连接失败:", err)
-			cm.IncrementErrors()
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer clientConn.Close()
 
-		// 获取真实房间ID
-		realRoomID, err := api.GetRealRoomID(roomID)
+		// 原样转发时客户端期望的压缩版本，未指定时按客户端认证包
+		protover := protoverAuto
+		if v := r.URL.Query().Get("protover"); v != "" {
+			if _, err := fmt.Sscanf(v, "%d", &protover); err != nil || protover < 0 || protover > protocol.VersionBrotli {
+				http.Error(w, "无效的protover参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// 低优先级消息的速率限制(条/秒)，0表示不限制
+		rate := defaultClientRate
+		if v := r.URL.Query().Get("rate"); v != "" {
+			if _, err := fmt.Sscanf(v, "%d", &rate); err != nil || rate < 0 {
+				http.Error(w, "无效的rate参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// 批量发送设置
+		batchWait, batchItems, err := parseBatchQuery(r.URL.Query())
 		if err != nil {
-			log.Printf("获取真实房间ID失败: %v", err)
-			cm.IncrementErrors()
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// 获取弹幕信息
-		token, hosts, err := api.GetDanmuInfo(realRoomID)
+		// 断线续传：补发该序号之后的事件
+		since := int64(-1)
+		if v := r.URL.Query().Get("since"); v != "" {
+			if _, err := fmt.Sscanf(v, "%d", &since); err != nil || since < 0 {
+				http.Error(w, "无效的since参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// 延迟发送，与延迟播出的直播画面同步
+		delay, err := parseDelay(r.URL.Query())
 		if err != nil {
-			log.Printf("获取弹幕信息失败: %v", err)
-			cm.IncrementErrors()
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// 随机选择一个服务器
-		host := hosts[rand.Intn(len(hosts))]
-		hostURL := fmt.Sprintf("wss://%s:%d/sub", host["host"], host["wss_port"])
+		// 新客户端默认先收到最近的历史弹幕，backfill=0关闭
+		backfill := r.URL.Query().Get("backfill") != "0"
+
+		id := auth.FromContext(r.Context())
+		client := &manager.Client{
+			RemoteAddr:  limit.ClientIP(r),
+			Identity:    id.Name,
+			Tenant:      id.Tenant,
+			RoomID:      roomID,
+			ConnectedAt: time.Now(),
+		}
+
+		// 先检查连接数限制，被拒绝的客户端不会产生B站请求
+		release, ok := admitClient(w, r, cm)
+		if !ok {
+			return
+		}
+		defer release()
 
-		// 连接到B站服务器
-		biliConn, _, err := websocket.DefaultDialer.Dial(hostURL, nil)
+		// 检查房间是否允许订阅
+		realRoomID, err := rooms.Check(roomID)
 		if err != nil {
-			log.Println("连接B站服务器失败:", err)
-			cm.IncrementErrors()
+			cm.Release()
+			rejectError(w, r, cm, err)
 			return
 		}
-		defer biliConn.Close()
 
-		// 创建认证包
-		buvid3 := config.GetConfig().Buvid3
-		authPacket, err := protocol.CreateAuthPacket(realRoomID, token, buvid3)
+		// 检查租户配额
+		account := tenant.Get(id.Tenant)
+		leave, err := admitTenant(account, realRoomID)
 		if err != nil {
-			log.Println("创建认证包失败:", err)
-			cm.IncrementErrors()
+			cm.Release()
+			rejectError(w, r, cm, err)
 			return
 		}
+		defer leave()
 
-		// 发送认证包
-		if err := biliConn.WriteMessage(websocket.BinaryMessage, authPacket); err != nil {
-			log.Println("发送认证包失败:", err)
-			cm.IncrementErrors()
+		// 升级客户端连接到WebSocket
+		clientConn, err := upgradeClient(w, r, cm, client)
+		if err != nil {
+			log.Println("升级客户端连接失败:", err)
+			cm.IncrementClientErrors(client)
+			cm.Release()
 			return
 		}
+		defer clientConn.Close()
 
-		// 启动心跳
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		go protocol.HandleHeartbeat(biliConn, cm)
+		session := newClientSession(cm, clientConn, client, initialFilter, protover, rate)
+		session.account = account
+		if batchWait > 0 {
+			session.batcher = newBatcher(session, batchWait, batchItems)
+		}
+
+		// 会话创建完成后再添加到连接管理器，统计接口读取时client已填写完整
+		cm.Register(clientConn, cancel, client)
+		defer cm.Remove(clientConn)
+
+		session.startLiveness()
+		go session.writeLoop(ctx)
 
-		// 添加到连接管理器
-		if !cm.Add(clientConn, cancel) {
-			log.Println("达到最大连接数限制")
+		// 原样转发的客户端按B站协议先收到认证回复
+		if !session.format.Decoded() {
+			session.write(websocket.BinaryMessage, authReplyPacket(0))
+		}
+
+		// 订阅房间事件
+		room, err := rooms.Join(roomID, session, hub.JoinOptions{Since: since, Backfill: backfill, Delay: delay})
+		if err != nil {
+			log.Printf("加入房间 %d 失败: %v", roomID, err)
+			cm.IncrementClientErrors(client)
+			session.closeWith(err)
 			return
 		}
-		defer cm.Remove(clientConn)
+		defer rooms.Leave(room, session)
 
-		log.Printf("已建立代理: %s <-> %s", r.RemoteAddr, hostURL)
-
-		// 双向转发数据
-		var wg sync.WaitGroup
-		wg.Add(2)
-
-		// 客户端 -> B站服务器
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					msgType, msg, err := clientConn.ReadMessage()
-					if err != nil {
-						return
-					}
-					if err := biliConn.WriteMessage(msgType, msg); err != nil {
-						return
-					}
-					cm.IncrementMessages()
-				}
-			}
-		}()
-
-		// B站服务器 -> 客户端
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					msgType, msg, err := biliConn.ReadMessage()
-					if err != nil {
-						return
-					}
-					if err := clientConn.WriteMessage(msgType, msg); err != nil {
-						return
-					}
-					cm.IncrementMessages()
-				}
-			}
-		}()
+		log.Printf("已建立代理: %s (%s) <-> 房间 %d", client.RemoteAddr, client.Identity, room.ID)
 
-		wg.Wait()
-		log.Printf("连接关闭: %s", r.RemoteAddr)
+		session.readLoop(room)
+		log.Printf("连接关闭: %s", client.RemoteAddr)
 	}
 }
 
-// 统计处理函数
+// 统计处理函数，clients=1时附带所有客户端的信息，客户端较多时可使用/stats/clients分页查询
 func StatsHandler(cm *manager.ConnectionManager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		stats := cm.Stats()
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(stats)
+		if r.URL.Query().Get("clients") != "1" {
+			json.NewEncoder(w).Encode(cm.Stats())
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			manager.ConnectionStats
+			Clients []manager.ClientStats `json:"clients"`
+		}{cm.Stats(), cm.ClientStats()})
 	}
 }
 
@@ -187,6 +208,7 @@ func QRCodeHandler(w http.ResponseWriter, r *http.Request) {
 		"ts":       {fmt.Sprintf("%d", time.Now().Unix())},
 	})
 	if err != nil {
+		metrics.LoginEvent("qrcode_failed")
 		http.Error(w, "申请二维码失败", http.StatusInternalServerError)
 		return
 	}
@@ -199,6 +221,7 @@ func QRCodeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if qrResp.Code != 0 {
+		metrics.LoginEvent("qrcode_failed")
 		http.Error(w, qrResp.Message, http.StatusInternalServerError)
 		return
 	}
@@ -229,6 +252,7 @@ func QRCodeHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 保存会话状态
 	utils.AddLoginSession(oauthKey, session)
+	metrics.LoginEvent("qrcode_issued")
 
 	// 返回二维码图片和oauth_key
 	w.Header().Set("Content-Type", "application/json")
@@ -254,6 +278,7 @@ func CheckLoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 检查是否过期
 	if time.Now().After(session.ExpiresAt) {
+		metrics.LoginEvent("expired")
 		http.Error(w, "二维码已过期", http.StatusBadRequest)
 		return
 	}
@@ -279,12 +304,15 @@ func CheckLoginHandler(w http.ResponseWriter, r *http.Request) {
 	session.Status = statusResp.Data.Status
 	if statusResp.Data.Status == 1 && session.ScanTime.IsZero() {
 		session.ScanTime = time.Now()
+		metrics.LoginEvent("scanned")
 	} else if statusResp.Data.Status == 2 && session.ConfirmTime.IsZero() {
 		session.ConfirmTime = time.Now()
+		metrics.LoginEvent("confirmed")
 
 		// 登录成功，获取Cookie
 		if err := utils.FetchLoginCookies(session); err != nil {
 			log.Printf("获取登录Cookie失败: %v", err)
+			metrics.LoginEvent("cookie_failed")
 		}
 	}
 
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	pingInterval = 30 * time.Second // 向客户端发送ping的间隔
+	idleTimeout  = 90 * time.Second // 超过该时间未收到客户端任何数据则断开
+	writeTimeout = 10 * time.Second // 单条消息的写超时
+)
+
+// 设置客户端存活检测，idle为0时不检测
+func SetLiveness(ping, idle time.Duration) error {
+	if idle > 0 && (ping <= 0 || ping >= idle) {
+		return fmt.Errorf("ping间隔必须大于0且小于空闲超时")
+	}
+	pingInterval, idleTimeout = ping, idle
+	return nil
+}
+
+// 开启存活检测：收到pong或任何消息都会延长读超时，超时后读取失败并释放连接
+func (s *clientSession) startLiveness() {
+	if idleTimeout <= 0 {
+		return
+	}
+	s.touch()
+	s.conn.SetPongHandler(func(string) error {
+		s.touch()
+		return nil
+	})
+}
+
+// 延长客户端连接的读超时，只能在读取客户端的goroutine中调用
+func (s *clientSession) touch() {
+	if idleTimeout > 0 {
+		s.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	}
+}
+
+// 写goroutine使用的ping定时器，未开启存活检测时返回nil
+func newPingTicker() *time.Ticker {
+	if idleTimeout <= 0 {
+		return nil
+	}
+	return time.NewTicker(pingInterval)
+}
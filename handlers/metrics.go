@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/FH-TianHe/BiliMux/auth"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/metrics"
+)
+
+// Prometheus格式的指标
+func MetricsHandler(cm *manager.ConnectionManager, rooms *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mw := metrics.NewWriter(w)
+		mw.WriteRegistered()
+
+		stats := cm.Stats()
+		mw.WriteValue("bilimux_clients", "当前连接的客户端数", "gauge", float64(stats.ActiveConnections))
+		mw.WriteValue("bilimux_connections_total", "累计的客户端连接数", "counter", float64(stats.TotalConnections))
+		mw.WriteValue("bilimux_dropped_messages_total", "因发送队列溢出丢弃的消息数", "counter", float64(stats.DroppedMessages))
+		mw.WriteValue("bilimux_errors_total", "错误数", "counter", float64(stats.Errors))
+		mw.WriteValue("bilimux_bytes_out_total", "发送给客户端的字节数(压缩前)", "counter", float64(stats.BytesOut))
+		mw.WriteValue("bilimux_wire_bytes_out_total", "发送给客户端的字节数(压缩后)", "counter", float64(stats.WireBytesOut))
+
+		var connected, subscribers []metrics.Sample
+		for _, room := range rooms.Rooms() {
+			info := room.Info()
+			labels := map[string]string{"room": strconv.Itoa(info.ID)}
+			up := 0.0
+			if info.Connected {
+				up = 1
+			}
+			connected = append(connected, metrics.Sample{Labels: labels, Value: up})
+			subscribers = append(subscribers, metrics.Sample{Labels: labels, Value: float64(info.Subscribers)})
+		}
+		mw.WriteSamples("bilimux_upstream_connected", "房间与B站服务器的连接是否正常", "gauge", connected)
+		mw.WriteSamples("bilimux_room_subscribers", "房间当前的订阅者数", "gauge", subscribers)
+
+		// 被拒绝的客户端按原因分类，认证失败和来源不允许的请求在auth包中统计
+		unauthorized, forbidden := auth.DenialCounts()
+		var rejected []metrics.Sample
+		for reason, n := range cm.RejectedCounts() {
+			rejected = append(rejected, metrics.Sample{Labels: map[string]string{"reason": reason}, Value: float64(n)})
+		}
+		sort.Slice(rejected, func(i, j int) bool { return rejected[i].Labels["reason"] < rejected[j].Labels["reason"] })
+		rejected = append(rejected,
+			metrics.Sample{Labels: map[string]string{"reason": "origin"}, Value: float64(auth.OriginRejections())},
+			metrics.Sample{Labels: map[string]string{"reason": "auth"}, Value: float64(unauthorized)},
+		)
+		mw.WriteSamples("bilimux_rejected_total", "被拒绝的客户端数，按原因(limit/ip/room/tenant/origin/auth)分类", "counter", rejected)
+
+		mw.WriteSamples("bilimux_auth_denied_total", "被拒绝的请求数", "counter", []metrics.Sample{
+			{Labels: map[string]string{"reason": "unauthorized"}, Value: float64(unauthorized)},
+			{Labels: map[string]string{"reason": "forbidden"}, Value: float64(forbidden)},
+		})
+		mw.Flush()
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/FH-TianHe/BiliMux/event"
+)
+
+// 发送队列溢出时的处理策略
+type QueuePolicy string
+
+const (
+	PolicyDropOldest QueuePolicy = "drop-oldest" // 丢弃队列中最旧的消息
+	PolicyDropNewest QueuePolicy = "drop-newest" // 丢弃新到的消息
+	PolicyDisconnect QueuePolicy = "disconnect"  // 断开慢速客户端
+)
+
+var (
+	sendQueueSize   = 256
+	sendQueuePolicy = PolicyDropOldest
+)
+
+// 设置每个客户端的发送队列长度和溢出策略
+func SetSendQueue(size int, policy string) error {
+	if size <= 0 {
+		return fmt.Errorf("发送队列长度必须大于0")
+	}
+	switch p := QueuePolicy(policy); p {
+	case PolicyDropOldest, PolicyDropNewest, PolicyDisconnect:
+		sendQueueSize, sendQueuePolicy = size, p
+		return nil
+	}
+	return fmt.Errorf("未知的溢出策略: %s", policy)
+}
+
+// 待发送给客户端的消息
+type outMessage struct {
+	msgType int
+	data    []byte
+	events  []*event.Event // 消息中包含的房间事件，写入客户端后计数
+}
+
+// 有界发送队列，由会话的写goroutine消费
+type sendQueue struct {
+	ch     chan outMessage
+	high   chan outMessage // 高优先级通道，消息从不丢弃
+	policy QueuePolicy
+	onDrop func(msg outMessage) // 按溢出策略丢弃消息时调用
+}
+
+func newSendQueue(size int, policy QueuePolicy, onDrop func(msg outMessage)) *sendQueue {
+	return &sendQueue{
+		ch:     make(chan outMessage, size),
+		high:   make(chan outMessage, size),
+		policy: policy,
+		onDrop: onDrop,
+	}
+}
+
+// 入队，普通通道已满时按策略处理；策略为断开时返回错误。
+// 高优先级通道已满说明客户端连礼物都来不及接收，宁可断开也不丢弃。
+func (q *sendQueue) push(msg outMessage, high bool) error {
+	if high {
+		select {
+		case q.high <- msg:
+			return nil
+		default:
+			return fmt.Errorf("客户端高优先级队列已满")
+		}
+	}
+
+	for {
+		select {
+		case q.ch <- msg:
+			return nil
+		default:
+		}
+
+		switch q.policy {
+		case PolicyDropNewest:
+			q.onDrop(msg)
+			return nil
+		case PolicyDisconnect:
+			return fmt.Errorf("客户端发送队列已满")
+		default:
+			// 腾出位置后重试，写goroutine可能同时取走消息
+			select {
+			case dropped := <-q.ch:
+				q.onDrop(dropped)
+			default:
+			}
+		}
+	}
+}
+
+// 当前排队的消息数
+func (q *sendQueue) len() int {
+	return len(q.ch) + len(q.high)
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/filter"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/metrics"
+	"github.com/FH-TianHe/BiliMux/protocol"
+	"github.com/FH-TianHe/BiliMux/tenant"
+)
+
+// 客户端连接，WebSocket和TCP客户端共用同一套会话逻辑
+type sessionConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	EnableWriteCompression(enable bool)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Subprotocol() string
+	Close() error
+}
+
+// 未指定protover参数，按客户端认证包中的protover压缩，收到认证包之前不压缩
+const protoverAuto = -1
+
+// 客户端会话
+type clientSession struct {
+	cm       *manager.ConnectionManager
+	conn     sessionConn
+	client   *manager.Client
+	roomID   int
+	format   event.Format // 通过子协议协商的输出格式
+	filter   clientFilter
+	protover int32 // 原样转发时客户端期望的压缩版本，为protoverAuto时按客户端认证包
+	shaper   *rateShaper
+	batcher  *batcher // 未开启批量发送时为nil
+	queue    *sendQueue
+	account  *tenant.Account // 不属于租户时为nil
+	closing  int32           // 已开始断开时为1，之后不再接收事件
+}
+
+func newClientSession(cm *manager.ConnectionManager, conn sessionConn, client *manager.Client, f *filter.Filter, protover, rate int) *clientSession {
+	s := &clientSession{
+		cm:       cm,
+		conn:     conn,
+		client:   client,
+		roomID:   client.RoomID,
+		format:   event.ParseFormat(conn.Subprotocol()),
+		filter:   clientFilter{f: f},
+		protover: int32(protover),
+		shaper:   newRateShaper(rate),
+	}
+	s.queue = newSendQueue(sendQueueSize, sendQueuePolicy, func(msg outMessage) {
+		cm.IncrementDropped(client)
+		s.account.Refund(len(msg.events))
+	})
+	client.QueueLen = s.queue.len
+	return s
+}
+
+// 将消息放入发送队列，队列溢出且策略为断开时返回错误
+func (s *clientSession) write(msgType int, data []byte) error {
+	return s.queue.push(outMessage{msgType: msgType, data: data}, false)
+}
+
+// 将高优先级消息放入单独的通道，不受溢出策略影响
+func (s *clientSession) writeHigh(msgType int, data []byte) error {
+	return s.queue.push(outMessage{msgType: msgType, data: data}, true)
+}
+
+// 将包含房间事件的消息放入发送队列。事件已在deliver中计费，
+// 入队失败时退还，写入客户端后才计入消息数。
+func (s *clientSession) writeEvents(msgType int, data []byte, events []*event.Event, high bool) error {
+	err := s.queue.push(outMessage{msgType: msgType, data: data, events: events}, high)
+	if err != nil {
+		s.account.Refund(len(events))
+	}
+	return err
+}
+
+// 已写入客户端的事件计入消息数
+func (s *clientSession) sent(events []*event.Event) {
+	for _, ev := range events {
+		s.cm.IncrementMessages(s.client)
+		metrics.MessageOut(ev.Cmd, ev.RawSize())
+	}
+}
+
+// 依次将发送队列中的消息写入客户端，高优先级通道优先，写入失败时关闭客户端连接
+func (s *clientSession) writeLoop(ctx context.Context) {
+	var summary <-chan time.Time
+	if s.shaper != nil {
+		ticker := time.NewTicker(skippedSummaryInterval)
+		defer ticker.Stop()
+		summary = ticker.C
+	}
+
+	var ping <-chan time.Time
+	if ticker := newPingTicker(); ticker != nil {
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		var msg outMessage
+		select {
+		case msg = <-s.queue.high:
+		default:
+			select {
+			case <-ctx.Done():
+				return
+			case msg = <-s.queue.high:
+			case msg = <-s.queue.ch:
+			case <-ping:
+				if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+					s.conn.Close()
+					return
+				}
+				continue
+			case <-summary:
+				n := s.shaper.takeSkipped()
+				if n == 0 {
+					continue
+				}
+				msgType, data, err := s.encodeOne(event.Notice(s.roomID, skippedCmd, skippedData(n)))
+				if err != nil {
+					log.Printf("编码跳过消息汇总失败: %v", err)
+					continue
+				}
+				msg = outMessage{msgType: msgType, data: data}
+			}
+		}
+
+		s.conn.EnableWriteCompression(shouldCompress(msg.data))
+		s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := s.conn.WriteMessage(msg.msgType, msg.data); err != nil {
+			s.conn.Close()
+			return
+		}
+		s.cm.AddBytesOut(s.client, len(msg.data))
+		s.account.AddBytes(len(msg.data))
+		s.sent(msg.events)
+	}
+}
+
+// 读取客户端消息：文本帧为控制消息，二进制帧按B站协议在本地应答心跳，
+// 未指定protover参数时采用客户端认证包中的protover
+func (s *clientSession) readLoop(room *hub.Room) {
+	for {
+		msgType, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.touch()
+
+		if msgType == websocket.TextMessage {
+			if err := handleControl(msg, s); err != nil {
+				return
+			}
+			continue
+		}
+
+		header, body, err := parseClientPacket(msg)
+		if err != nil {
+			continue
+		}
+		switch header.Operation {
+		case protocol.OpAuth:
+			var auth protocol.AuthBody
+			if json.Unmarshal(body, &auth) == nil {
+				atomic.CompareAndSwapInt32(&s.protover, protoverAuto, int32(auth.ProtoVer))
+			}
+		case protocol.OpHeartbeat:
+			if err := s.write(websocket.BinaryMessage, heartbeatReplyPacket(room.Popularity())); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// 消息是否应发送给客户端：先按过滤规则筛选，再按速率预算采样
+func (s *clientSession) keep(f *filter.Filter, msg *protocol.Message) bool {
+	if f != nil && !f.Match(msg) {
+		return false
+	}
+	return s.shaper == nil || s.shaper.allow(msg)
+}
+
+// 接收房间事件，在房间的goroutine中调用，放入发送队列失败时断开客户端
+func (s *clientSession) Deliver(events []*event.Event) {
+	if atomic.LoadInt32(&s.closing) != 0 {
+		return
+	}
+	if err := s.deliver(events); err != nil {
+		if _, ok := err.(*tenant.QuotaError); ok {
+			s.closeAsync(err)
+			return
+		}
+		atomic.StoreInt32(&s.closing, 1)
+		s.conn.Close()
+	}
+}
+
+func (s *clientSession) deliver(events []*event.Event) error {
+	f := s.filter.Get()
+	kept := make([]*event.Event, 0, len(events))
+	high := false
+	for _, ev := range events {
+		// 通知事件不受过滤规则和速率限制
+		if msg := ev.Message(); msg != nil && !s.keep(f, msg) {
+			continue
+		}
+		kept = append(kept, ev)
+		high = high || isHigh(ev)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	// 先占用额度，没有发送出去的消息再退还
+	if !s.account.Spend(len(kept)) {
+		return &tenant.QuotaError{Message: "本月的消息额度已用完"}
+	}
+
+	if !s.format.Decoded() {
+		data, err := s.encodeRaw(kept)
+		if err != nil {
+			log.Printf("封装数据包失败: %v", err)
+			s.cm.IncrementClientErrors(s.client)
+			s.account.Refund(len(kept))
+			return nil
+		}
+		if s.batcher != nil {
+			return s.batcher.addRaw(data, kept, high)
+		}
+		return s.writeEvents(websocket.BinaryMessage, data, kept, high)
+	}
+
+	for i, ev := range kept {
+		if s.batcher != nil {
+			if err := s.batcher.addEvent(ev, isHigh(ev)); err != nil {
+				s.account.Refund(len(kept) - i - 1)
+				return err
+			}
+			continue
+		}
+
+		data, err := event.Encode(s.format, ev)
+		if err != nil {
+			log.Printf("编码事件失败: %v", err)
+			s.cm.IncrementClientErrors(s.client)
+			s.account.Refund(1)
+			continue
+		}
+		if err := s.writeEvents(s.format.MessageType(), data, []*event.Event{ev}, isHigh(ev)); err != nil {
+			s.account.Refund(len(kept) - i - 1)
+			return err
+		}
+	}
+	return nil
+}
+
+// 高优先级事件(礼物、醒目留言等)走单独的通道，无论是否开启速率限制都不会被丢弃
+func isHigh(ev *event.Event) bool {
+	return messagePriority(ev.Cmd) == priorityHigh
+}
+
+// 将事件封装为B站格式的数据包，并按客户端期望的版本压缩。
+// 收到的是整批事件时与同房间的其他客户端共享编码结果
+func (s *clientSession) encodeRaw(events []*event.Event) ([]byte, error) {
+	version := protocol.NormalizeVersion(int(atomic.LoadInt32(&s.protover)))
+	if b := events[0].Batch(); b != nil && b.Whole(events) {
+		return b.Frame(version, func() ([]byte, error) {
+			return s.encodePackets(events, version)
+		})
+	}
+	return s.encodePackets(events, version)
+}
+
+func (s *clientSession) encodePackets(events []*event.Event, version uint16) ([]byte, error) {
+	var packets []byte
+	for _, ev := range events {
+		body, err := ev.Body()
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, protocol.EncodePacket(protocol.OpMessage, protocol.VersionPlain, body)...)
+	}
+	if version == protocol.VersionPlain {
+		return packets, nil
+	}
+
+	start := time.Now()
+	defer func() {
+		s.cm.AddTranscodeTime(time.Since(start))
+	}()
+	return protocol.CompressPackets(packets, version)
+}
+
+// 按客户端的输出格式编码单个事件
+func (s *clientSession) encodeOne(ev *event.Event) (int, []byte, error) {
+	if s.format.Decoded() {
+		data, err := event.Encode(s.format, ev)
+		return s.format.MessageType(), data, err
+	}
+	data, err := s.encodeRaw([]*event.Event{ev})
+	return websocket.BinaryMessage, data, err
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/protocol"
+	"github.com/FH-TianHe/BiliMux/tenant"
+)
+
+// 不连接网络的客户端连接，记录写入的消息和关闭次数
+type fakeConn struct {
+	mu       sync.Mutex
+	writes   [][]byte
+	controls int
+	closes   int
+}
+
+func (c *fakeConn) ReadMessage() (int, []byte, error) { select {} }
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes = append(c.writes, data)
+	return nil
+}
+
+func (c *fakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.controls++
+	return nil
+}
+
+func (c *fakeConn) EnableWriteCompression(enable bool)          {}
+func (c *fakeConn) SetReadDeadline(t time.Time) error           { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error          { return nil }
+func (c *fakeConn) SetPongHandler(h func(appData string) error) {}
+func (c *fakeConn) Subprotocol() string                         { return "" }
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closes++
+	return nil
+}
+
+// 不开启速率限制的原样转发会话
+func testSession(t *testing.T, queueSize int, policy QueuePolicy) (*clientSession, *fakeConn) {
+	t.Helper()
+	if err := SetSendQueue(queueSize, string(policy)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetSendQueue(256, string(PolicyDropOldest)) })
+	conn := &fakeConn{}
+	s := newClientSession(manager.NewConnectionManager(10), conn, &manager.Client{RoomID: 1}, nil, 0, 0)
+	return s, conn
+}
+
+func testEvent(t *testing.T, body string) *event.Event {
+	t.Helper()
+	msg, err := protocol.ParseMessage([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event.FromMessage(1, msg)
+}
+
+func TestDeliverPriorityWithoutShaper(t *testing.T) {
+	danmu := `{"cmd":"DANMU_MSG","info":[[],"弹幕",[1,"用户"]]}`
+	gift := `{"cmd":"SEND_GIFT","data":{"uid":2,"coin_type":"gold","total_coin":100}}`
+	sc := `{"cmd":"SUPER_CHAT_MESSAGE","data":{"uid":3,"message":"醒目留言"}}`
+
+	for _, policy := range []QueuePolicy{PolicyDropOldest, PolicyDropNewest} {
+		t.Run(string(policy), func(t *testing.T) {
+			s, _ := testSession(t, 2, policy)
+			if s.shaper != nil {
+				t.Fatal("速率为0时不应有限速器")
+			}
+			// 普通通道溢出后继续发送礼物和醒目留言
+			for i := 0; i < 5; i++ {
+				s.Deliver([]*event.Event{testEvent(t, danmu)})
+			}
+			s.Deliver([]*event.Event{testEvent(t, gift)})
+			s.Deliver([]*event.Event{testEvent(t, sc)})
+			for i := 0; i < 5; i++ {
+				s.Deliver([]*event.Event{testEvent(t, danmu)})
+			}
+
+			if got := len(s.queue.high); got != 2 {
+				t.Errorf("高优先级通道有 %d 条消息, want 2", got)
+			}
+			if got := len(s.queue.ch); got != 2 {
+				t.Errorf("普通通道有 %d 条消息, want 2", got)
+			}
+		})
+	}
+}
+
+func TestDeliverQuotaClosesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"tenants":[{"name":"quota","key":"k","message_budget":1}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ioutil.WriteFile(path, []byte(`{"tenants":[]}`), 0644)
+		config.LoadConfig(path)
+	})
+
+	s, conn := testSession(t, 256, PolicyDropOldest)
+	s.account = tenant.Get("quota")
+	danmu := `{"cmd":"DANMU_MSG","info":[[],"弹幕",[1,"用户"]]}`
+	for i := 0; i < 50; i++ {
+		s.Deliver([]*event.Event{testEvent(t, danmu)})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn.mu.Lock()
+		closes := conn.closes
+		conn.mu.Unlock()
+		if closes > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.closes != 1 || conn.controls != 1 {
+		t.Errorf("关闭 %d 次、发送关闭帧 %d 次, want 1", conn.closes, conn.controls)
+	}
+	if got := len(s.queue.ch); got != 1 {
+		t.Errorf("发送队列中有 %d 条消息, want 1", got)
+	}
+}
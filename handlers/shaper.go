@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// 消息优先级
+const (
+	priorityLow    = iota // 普通弹幕、进场等，超出速率时被采样丢弃
+	priorityNormal        // 其他消息，不受速率限制
+	priorityHigh          // 醒目留言、上舰、礼物，从不丢弃
+)
+
+// 跳过消息汇总的发送间隔
+const skippedSummaryInterval = 5 * time.Second
+
+// 跳过消息汇总使用的命令名
+const skippedCmd = "BILIMUX_SKIPPED"
+
+// 客户端默认的消息速率限制(条/秒)，0表示不限制
+var defaultClientRate = 0
+
+// 设置客户端默认的消息速率限制
+func SetClientRate(rate int) {
+	defaultClientRate = rate
+}
+
+func messagePriority(cmd string) int {
+	switch cmd {
+	case "SUPER_CHAT_MESSAGE", "SUPER_CHAT_MESSAGE_JPN", "GUARD_BUY", "USER_TOAST_MSG", "SEND_GIFT", "COMBO_SEND":
+		return priorityHigh
+	case "DANMU_MSG", "INTERACT_WORD", "ENTRY_EFFECT", "LIKE_INFO_V3_CLICK":
+		return priorityLow
+	}
+	return priorityNormal
+}
+
+// 按令牌桶对低优先级消息采样
+type rateShaper struct {
+	mu      sync.Mutex
+	rate    float64
+	tokens  float64
+	last    time.Time
+	skipped int64
+}
+
+// 创建速率整形器，rate不大于0时返回nil表示不限制
+func newRateShaper(rate int) *rateShaper {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateShaper{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// 判断消息是否在速率预算内，只有低优先级消息会被跳过
+func (r *rateShaper) allow(msg *protocol.Message) bool {
+	if messagePriority(msg.Cmd) != priorityLow {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.rate {
+		r.tokens = r.rate
+	}
+	r.last = now
+
+	if r.tokens < 1 {
+		r.skipped++
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// 取出并清零跳过的消息数
+func (r *rateShaper) takeSkipped() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.skipped
+	r.skipped = 0
+	return n
+}
+
+// 跳过消息汇总的内容
+func skippedData(n int64) map[string]interface{} {
+	return map[string]interface{}{
+		"skipped":  n,
+		"interval": int(skippedSummaryInterval / time.Second),
+	}
+}
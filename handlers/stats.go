@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/manager"
+)
+
+// 分页参数的默认值和上限
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// 分页后的列表
+type page struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  interface{} `json:"items"`
+}
+
+// 按URL参数排序和分页：sort为字段名，order为asc或desc(默认)，offset和limit指定范围。
+// keys为可排序的字段及其取值，返回排序后的下标。
+func paginate(query url.Values, n int, keys map[string]func(i int) float64, defaultKey string) (indexes []int, offset, limit int, err error) {
+	key := defaultKey
+	if v := query.Get("sort"); v != "" {
+		key = v
+	}
+	value, ok := keys[key]
+	if !ok {
+		return nil, 0, 0, fmt.Errorf("无效的sort参数")
+	}
+	desc := true
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		desc = false
+	default:
+		return nil, 0, 0, fmt.Errorf("无效的order参数")
+	}
+
+	limit = defaultPageSize
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxPageSize {
+			return nil, 0, 0, fmt.Errorf("无效的limit参数")
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return nil, 0, 0, fmt.Errorf("无效的offset参数")
+		}
+	}
+
+	indexes = make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		if desc {
+			return value(indexes[a]) > value(indexes[b])
+		}
+		return value(indexes[a]) < value(indexes[b])
+	})
+
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+	return indexes[offset:end], offset, limit, nil
+}
+
+// 每个房间的统计，可按room_id、subscribers、messages、rate、bytes、errors、reconnects、connected排序
+func RoomStatsHandler(rooms *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var infos []hub.RoomInfo
+		for _, room := range rooms.Rooms() {
+			infos = append(infos, room.Info())
+		}
+
+		indexes, offset, limit, err := paginate(r.URL.Query(), len(infos), map[string]func(i int) float64{
+			"room_id":     func(i int) float64 { return float64(infos[i].ID) },
+			"subscribers": func(i int) float64 { return float64(infos[i].Subscribers) },
+			"messages":    func(i int) float64 { return float64(infos[i].MessagesIn) },
+			"rate":        func(i int) float64 { return infos[i].MessagesPerSec },
+			"bytes":       func(i int) float64 { return float64(infos[i].BytesIn) },
+			"errors":      func(i int) float64 { return float64(infos[i].Errors) },
+			"reconnects":  func(i int) float64 { return float64(infos[i].Reconnects) },
+			"connected":   func(i int) float64 { return float64(infos[i].ConnectedSeconds) },
+		}, "subscribers")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		items := make([]hub.RoomInfo, 0, len(indexes))
+		for _, i := range indexes {
+			items = append(items, infos[i])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page{Total: len(infos), Offset: offset, Limit: limit, Items: items})
+	}
+}
+
+// 每个客户端的统计，可按room_id、messages、rate、bytes、dropped、errors、queue、connected排序
+func ClientStatsHandler(cm *manager.ConnectionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clients := cm.ClientStats()
+
+		indexes, offset, limit, err := paginate(r.URL.Query(), len(clients), map[string]func(i int) float64{
+			"room_id":   func(i int) float64 { return float64(clients[i].RoomID) },
+			"messages":  func(i int) float64 { return float64(clients[i].Messages) },
+			"rate":      func(i int) float64 { return clients[i].MessagesPerSec },
+			"bytes":     func(i int) float64 { return float64(clients[i].BytesOut) },
+			"dropped":   func(i int) float64 { return float64(clients[i].Dropped) },
+			"errors":    func(i int) float64 { return float64(clients[i].Errors) },
+			"queue":     func(i int) float64 { return float64(clients[i].QueueLen) },
+			"connected": func(i int) float64 { return float64(clients[i].ConnectedSeconds) },
+		}, "messages")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		items := make([]manager.ClientStats, 0, len(indexes))
+		for _, i := range indexes {
+			items = append(items, clients[i])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page{Total: len(clients), Offset: offset, Limit: limit, Items: items})
+	}
+}
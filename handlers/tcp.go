@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/limit"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// TCP客户端单个数据包的最大长度，与WebSocket客户端相同。
+// 压缩的包体由parseClientPacket拒绝，不会被解压
+const maxTCPPacketSize = maxClientMessageSize
+
+// 在TCP端口上按B站弹幕服务器的TCP协议服务客户端，直到监听关闭
+func ServeTCP(ln net.Listener, cm *manager.ConnectionManager, rooms *hub.Hub) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// 超时和文件描述符耗尽是暂时的，稍后重试
+			if ne, ok := err.(net.Error); ok && ne.Timeout() || errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+				log.Printf("接受TCP连接失败: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go handleTCP(conn, cm, rooms)
+	}
+}
+
+func handleTCP(conn net.Conn, cm *manager.ConnectionManager, rooms *hub.Hub) {
+	// TCP协议没有拒绝原因，超出限制时直接断开
+	ip := limit.AddrIP(conn.RemoteAddr())
+	if err := limit.Open(ip); err != nil {
+		log.Printf("拒绝TCP客户端: %s: %v", ip, err)
+		cm.IncrementRejected(manager.RejectIP)
+		conn.Close()
+		return
+	}
+	defer limit.Close(ip)
+	if !admit(context.Background(), cm) {
+		log.Printf("拒绝TCP客户端: %s: 达到最大连接数限制", ip)
+		cm.IncrementRejected(manager.RejectLimit)
+		conn.Close()
+		return
+	}
+
+	client := &manager.Client{
+		RemoteAddr:  conn.RemoteAddr().String(),
+		ConnectedAt: time.Now(),
+	}
+	tc := newTCPConn(&countingConn{Conn: conn, cm: cm, client: client})
+	defer tc.Close()
+
+	serveEmulated(tc, cm, rooms, client, 0, "")
+}
+
+// TCP客户端连接：数据包首尾相连，没有WebSocket的消息边界和控制帧
+type tcpConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newTCPConn(conn net.Conn) *tcpConn {
+	return &tcpConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// 读取一个完整的数据包
+func (c *tcpConn) ReadMessage() (int, []byte, error) {
+	header := make([]byte, protocol.HeaderLength)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, nil, err
+	}
+	packetLen := binary.BigEndian.Uint32(header[0:4])
+	if packetLen < protocol.HeaderLength || packetLen > maxTCPPacketSize {
+		return 0, nil, fmt.Errorf("无效的数据包长度: %d", packetLen)
+	}
+
+	packet := make([]byte, packetLen)
+	copy(packet, header)
+	if _, err := io.ReadFull(c.r, packet[protocol.HeaderLength:]); err != nil {
+		return 0, nil, err
+	}
+	return websocket.BinaryMessage, packet, nil
+}
+
+// 直接写入数据包，TCP客户端只会收到B站格式的二进制数据
+func (c *tcpConn) WriteMessage(messageType int, data []byte) error {
+	_, err := c.Conn.Write(data)
+	return err
+}
+
+// TCP没有控制帧，客户端存活依靠心跳包和读超时检测
+func (c *tcpConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return nil
+}
+
+func (c *tcpConn) EnableWriteCompression(enable bool) {}
+
+func (c *tcpConn) SetPongHandler(h func(appData string) error) {}
+
+func (c *tcpConn) Subprotocol() string {
+	return ""
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// 以chunk字节为单位分多次写入数据，模拟TCP流任意切分
+func writeChunks(conn net.Conn, data []byte, chunk int) {
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := conn.Write(data[:n]); err != nil {
+			return
+		}
+		data = data[n:]
+	}
+	conn.Close()
+}
+
+func TestTCPConnReadMessage(t *testing.T) {
+	auth := protocol.EncodePacket(protocol.OpAuth, 1, []byte(`{"roomid":1,"protover":3}`))
+	heartbeat := protocol.EncodePacket(protocol.OpHeartbeat, 1, nil)
+	stream := append(append([]byte(nil), auth...), heartbeat...)
+
+	tooLong := make([]byte, protocol.HeaderLength)
+	binary.BigEndian.PutUint32(tooLong, maxTCPPacketSize+1)
+	tooShort := append([]byte(nil), heartbeat...)
+	binary.BigEndian.PutUint32(tooShort, protocol.HeaderLength-1)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		chunk   int
+		want    [][]byte
+		wantErr error // 读完want之后的错误，nil表示任意错误
+	}{
+		{"一次写入多个数据包", stream, len(stream), [][]byte{auth, heartbeat}, io.EOF},
+		{"逐字节写入", stream, 1, [][]byte{auth, heartbeat}, io.EOF},
+		{"包头被切开", stream, 7, [][]byte{auth, heartbeat}, io.EOF},
+		{"包体不完整", auth[:len(auth)-1], len(auth), nil, io.ErrUnexpectedEOF},
+		{"包头不完整", auth[:protocol.HeaderLength-1], 4, nil, io.ErrUnexpectedEOF},
+		{"数据包过长", tooLong, len(tooLong), nil, nil},
+		{"长度小于包头", tooShort, len(tooShort), nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go writeChunks(client, tt.data, tt.chunk)
+
+			tc := newTCPConn(server)
+			for i, want := range tt.want {
+				_, got, err := tc.ReadMessage()
+				if err != nil {
+					t.Fatalf("读取数据包 %d 失败: %v", i, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("数据包 %d = %x, want %x", i, got, want)
+				}
+			}
+			_, _, err := tc.ReadMessage()
+			if err == nil {
+				t.Fatal("应返回错误")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 用zlib压缩的认证包，服务端不应解压
+func compressedAuth(t *testing.T) []byte {
+	t.Helper()
+	auth := protocol.EncodePacket(protocol.OpAuth, 1, []byte(`{"roomid":5440}`))
+	data, err := protocol.CompressPackets(auth, protocol.VersionZlib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint32(data[8:12], protocol.OpAuth)
+	return data
+}
+
+func TestReadClientAuthTCP(t *testing.T) {
+	tests := []struct {
+		name     string
+		packet   []byte
+		wantRoom int
+		wantErr  bool
+	}{
+		{"认证包", protocol.EncodePacket(protocol.OpAuth, 1, []byte(`{"roomid":5440,"protover":3,"key":"k"}`)), 5440, false},
+		{"首个数据包不是认证包", protocol.EncodePacket(protocol.OpHeartbeat, 1, nil), 0, true},
+		{"认证包不是JSON", protocol.EncodePacket(protocol.OpAuth, 1, []byte("roomid=1")), 0, true},
+		{"房间ID无效", protocol.EncodePacket(protocol.OpAuth, 1, []byte(`{"roomid":0}`)), 0, true},
+		{"压缩的认证包", compressedAuth(t), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go writeChunks(client, tt.packet, 3)
+
+			body, err := readClientAuth(newTCPConn(server))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && body.RoomID != tt.wantRoom {
+				t.Errorf("RoomID = %d, want %d", body.RoomID, tt.wantRoom)
+			}
+		})
+	}
+}
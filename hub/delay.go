@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/event"
+)
+
+// 每个房间同时存在的延迟队列数上限，每个队列有自己的定时器和缓冲
+const maxDelayLines = 16
+
+// 延迟队列：同一房间、同一延迟的订阅者共享，事件在收到后经过指定时间再发送
+type delayLine struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending []delayedEvents
+	subs    map[Subscriber]struct{}
+	lastSeq uint64 // 已发送的最大序号
+	timer   *time.Timer
+	closed  bool
+}
+
+type delayedEvents struct {
+	at     time.Time
+	events []*event.Event
+}
+
+// 创建延迟队列，补发窗口中尚未到期的事件直接进入队列，使新的队列立即与延迟同步。
+// 调用时需持有房间的锁。
+func newDelayLine(r *Room, delay time.Duration) *delayLine {
+	l := &delayLine{
+		delay:   delay,
+		subs:    make(map[Subscriber]struct{}),
+		lastSeq: r.seq,
+	}
+	now := time.Now()
+	for _, ev := range r.replay.since(0) {
+		at := time.UnixMilli(ev.Time).Add(delay)
+		if !at.After(now) {
+			continue
+		}
+		if len(l.pending) == 0 {
+			l.lastSeq = ev.Seq - 1
+		}
+		l.pending = append(l.pending, delayedEvents{at: at, events: []*event.Event{ev}})
+	}
+	if len(l.pending) > 0 {
+		l.timer = time.AfterFunc(time.Until(l.pending[0].at), l.release)
+	}
+	return l
+}
+
+// 放入新收到的事件
+func (l *delayLine) push(events []*event.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.pending = append(l.pending, delayedEvents{at: time.Now().Add(l.delay), events: events})
+	if l.timer == nil {
+		l.timer = time.AfterFunc(l.delay, l.release)
+	}
+}
+
+// 发送所有已到期的事件，并为下一批事件设置定时器
+func (l *delayLine) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timer = nil
+	if l.closed {
+		return
+	}
+
+	now := time.Now()
+	n := 0
+	for n < len(l.pending) && !l.pending[n].at.After(now) {
+		events := l.pending[n].events
+		for sub := range l.subs {
+			sub.Deliver(events)
+		}
+		l.lastSeq = events[len(events)-1].Seq
+		n++
+	}
+	l.pending = l.pending[n:]
+
+	if len(l.pending) > 0 {
+		l.timer = time.AfterFunc(l.pending[0].at.Sub(now), l.release)
+	}
+}
+
+// 移除订阅者，返回队列是否已经没有订阅者
+func (l *delayLine) remove(sub Subscriber) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subs, sub)
+	return len(l.subs) == 0
+}
+
+func (l *delayLine) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.pending = nil
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+}
@@ -0,0 +1,149 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/event"
+)
+
+// 等待订阅者收到n个事件，超时返回已收到的事件
+func waitFor(sub *recorder, n int, timeout time.Duration) []*event.Event {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if got := sub.received(); len(got) >= n {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return sub.received()
+}
+
+func TestDelayLine(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	r := testRoom(10)
+	sub := &recorder{}
+	if err := r.subscribe(sub, JoinOptions{Since: -1, Delay: delay}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	broadcastN(r, 2)
+	if got := sub.received(); len(got) != 0 {
+		t.Fatalf("延迟到期前收到 %v", seqs(got))
+	}
+	got := waitFor(sub, 2, time.Second)
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("%v 后就收到事件，want >= %v", elapsed, delay)
+	}
+	if s := seqs(got); !equalSeqs(s, []uint64{1, 2}) {
+		t.Errorf("收到 %v, want [1 2]", s)
+	}
+	line := r.subs[sub]
+	line.mu.Lock()
+	defer line.mu.Unlock()
+	if line.lastSeq != 2 {
+		t.Errorf("lastSeq = %d, want 2", line.lastSeq)
+	}
+}
+
+func TestDelayLineShared(t *testing.T) {
+	r := testRoom(10)
+	a, b, live := &recorder{}, &recorder{}, &recorder{}
+	for _, sub := range []*recorder{a, b} {
+		if err := r.subscribe(sub, JoinOptions{Since: -1, Delay: 50 * time.Millisecond}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.subscribe(live, JoinOptions{Since: -1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.delays) != 1 {
+		t.Errorf("相同延迟应共享一个队列，有 %d 个", len(r.delays))
+	}
+
+	broadcastN(r, 1)
+	if len(live.received()) != 1 {
+		t.Error("实时订阅者应立即收到事件")
+	}
+	for _, sub := range []*recorder{a, b} {
+		if got := waitFor(sub, 1, time.Second); len(got) != 1 {
+			t.Errorf("延迟订阅者收到 %d 个事件", len(got))
+		}
+	}
+
+	// 最后一个订阅者离开后队列关闭
+	r.unsubscribe(a)
+	r.unsubscribe(b)
+	if len(r.delays) != 0 {
+		t.Errorf("延迟队列没有关闭")
+	}
+}
+
+func TestNewDelayLineCatchUp(t *testing.T) {
+	const delay = time.Minute
+	r := testRoom(10)
+	old := time.Now().Add(-2 * delay).UnixMilli()
+	r.broadcast([]*event.Event{{Cmd: "DANMU_MSG", Time: old}, {Cmd: "DANMU_MSG", Time: old}})
+	broadcastN(r, 2)
+
+	// 已经超过延迟的事件视为已发送，尚未到期的进入队列
+	line := newDelayLine(r, delay)
+	defer line.close()
+	if line.lastSeq != 2 {
+		t.Errorf("lastSeq = %d, want 2", line.lastSeq)
+	}
+	if len(line.pending) != 2 || line.pending[0].events[0].Seq != 3 {
+		t.Errorf("队列中有 %d 批事件", len(line.pending))
+	}
+}
+
+func TestDelayedResume(t *testing.T) {
+	const delay = time.Minute
+	r := testRoom(10)
+	first := &recorder{}
+	if err := r.subscribe(first, JoinOptions{Since: -1, Delay: delay}, nil); err != nil {
+		t.Fatal(err)
+	}
+	broadcastN(r, 3)
+
+	// 续传时只补发延迟队列已经发送过的事件，尚未到期的随队列发送
+	line := r.subs[first]
+	line.mu.Lock()
+	line.lastSeq = 1
+	line.mu.Unlock()
+	resumed := &recorder{}
+	if err := r.subscribe(resumed, JoinOptions{Since: 0, Delay: delay}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := seqs(resumed.received()); !equalSeqs(s, []uint64{1}) {
+		t.Errorf("补发 %v, want [1]", s)
+	}
+	r.unsubscribe(first)
+	r.unsubscribe(resumed)
+}
+
+func TestDelayLineLimit(t *testing.T) {
+	r := testRoom(10)
+	defer r.close()
+	for i := 1; i <= maxDelayLines; i++ {
+		if err := r.subscribe(&recorder{}, JoinOptions{Since: -1, Delay: time.Duration(i) * time.Minute}, nil); err != nil {
+			t.Fatalf("第 %d 个延迟队列: %v", i, err)
+		}
+	}
+
+	err := r.subscribe(&recorder{}, JoinOptions{Since: -1, Delay: time.Hour}, nil)
+	if e, ok := err.(*Error); !ok || e.Code != CodeRoomFull {
+		t.Errorf("超出上限时 err = %v, want %d", err, CodeRoomFull)
+	}
+	// 已有的延迟和实时订阅不受影响
+	if err := r.subscribe(&recorder{}, JoinOptions{Since: -1, Delay: time.Minute}, nil); err != nil {
+		t.Errorf("加入已有的延迟队列: %v", err)
+	}
+	if err := r.subscribe(&recorder{}, JoinOptions{Since: -1}, nil); err != nil {
+		t.Errorf("实时订阅: %v", err)
+	}
+	if len(r.delays) != maxDelayLines {
+		t.Errorf("有 %d 个延迟队列, want %d", len(r.delays), maxDelayLines)
+	}
+}
@@ -0,0 +1,90 @@
+package hub
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/api"
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// B站历史弹幕的时间为北京时间
+var historyLocation = time.FixedZone("CST", 8*3600)
+
+// 请求历史弹幕失败后多久再重试，期间使用旧的缓存
+const historyRetryTTL = 10 * time.Second
+
+// 房间最近的历史弹幕，缓存一段时间以免每个客户端加入时都请求B站
+type historyCache struct {
+	mu       sync.Mutex
+	events   []*event.Event
+	expires  time.Time
+	fetching chan struct{} // 正在请求B站时不为nil，请求结束后关闭
+}
+
+// 获取历史弹幕，缓存过期时重新请求，请求失败时返回旧的缓存。
+// 同时加入的客户端只发出一个请求，请求期间不持有锁。
+func (r *Room) history() []*event.Event {
+	c := &r.historyCache
+	c.mu.Lock()
+	if time.Now().Before(c.expires) {
+		defer c.mu.Unlock()
+		return c.events
+	}
+	if wait := c.fetching; wait != nil {
+		c.mu.Unlock()
+		<-wait
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.events
+	}
+	done := make(chan struct{})
+	c.fetching = done
+	c.mu.Unlock()
+
+	events, err := r.fetchHistory()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		log.Printf("房间 %d 获取历史弹幕失败: %v", r.ID, err)
+		r.incrementErrors()
+		retry := historyRetryTTL
+		if r.hub.historyTTL < retry {
+			retry = r.hub.historyTTL
+		}
+		c.expires = time.Now().Add(retry)
+	} else {
+		c.events, c.expires = events, time.Now().Add(r.hub.historyTTL)
+	}
+	c.fetching = nil
+	close(done)
+	return c.events
+}
+
+// 请求B站的历史弹幕并转换为事件
+func (r *Room) fetchHistory() ([]*event.Event, error) {
+	items, err := api.GetHistory(r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*event.Event, 0, len(items))
+	for _, item := range items {
+		sentAt, err := time.ParseInLocation("2006-01-02 15:04:05", item.Timeline, historyLocation)
+		if err != nil {
+			sentAt = time.Now()
+		}
+		events = append(events, event.History(r.ID, &protocol.Message{
+			Cmd:        "DANMU_MSG",
+			Raw:        item.Raw,
+			Text:       item.Text,
+			UID:        item.UID,
+			Uname:      item.Nickname,
+			GuardLevel: item.GuardLevel,
+		}, sentAt))
+	}
+	return events, nil
+}
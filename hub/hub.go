@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/api"
+	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/manager"
+)
+
+// 订阅房间事件的客户端
+//
+// Deliver在房间的goroutine中按序号顺序调用，不能阻塞。
+type Subscriber interface {
+	Deliver(events []*event.Event)
+}
+
+// 可以被服务端断开的订阅者。房间被管理员关闭时，Kick在房间关闭之后调用，
+// 调用时不持有房间锁，房间已不再投递事件；Kick逐个同步调用，不能阻塞
+type Kicker interface {
+	Kick(err error)
+}
+
+// 房间集合的设置
+type Options struct {
+	ReplayWindow int           // 每个房间保留的最近事件数
+	Linger       time.Duration // 最后一个客户端离开后房间保留的时间
+	HistoryTTL   time.Duration // 历史弹幕的缓存时间，0表示不补发历史弹幕
+}
+
+// 加入房间的选项
+type JoinOptions struct {
+	Since    int64         // 大于等于0时补发该序号之后的事件
+	Backfill bool          // 是否在实时事件之前补发历史弹幕，续传时忽略
+	Delay    time.Duration // 大于0时事件在收到后经过该时间再发送
+}
+
+// 房间集合，同一房间的客户端共享一条B站连接
+type Hub struct {
+	cm           *manager.ConnectionManager
+	replayWindow int
+	linger       time.Duration
+	historyTTL   time.Duration
+	roomIDs      roomIDCache
+
+	mu    sync.Mutex
+	rooms map[int]*Room // 真实房间ID -> 房间
+}
+
+func New(cm *manager.ConnectionManager, opts Options) *Hub {
+	return &Hub{
+		cm:           cm,
+		replayWindow: opts.ReplayWindow,
+		linger:       opts.Linger,
+		historyTTL:   opts.HistoryTTL,
+		rooms:        make(map[int]*Room),
+	}
+}
+
+// 解析真实房间ID，结果缓存在容量有限的缓存中。
+// 房间不存在时返回CodeRoomNotFound，无法访问B站时返回CodeUpstreamFailure。
+func (h *Hub) ResolveRoomID(roomID int) (int, error) {
+	if e, ok := h.roomIDs.get(roomID); ok {
+		return e.realRoomID, e.err
+	}
+	realRoomID, err := api.GetRealRoomID(roomID)
+	if errors.Is(err, api.ErrRoomNotFound) {
+		err := &Error{Code: CodeRoomNotFound, Message: err.Error()}
+		h.roomIDs.set(roomID, roomIDEntry{err: err, expires: time.Now().Add(notFoundTTL)})
+		return 0, err
+	}
+	if err != nil {
+		return 0, &Error{Code: CodeUpstreamFailure, Message: fmt.Sprintf("获取真实房间ID失败: %v", err)}
+	}
+	h.roomIDs.set(roomID, roomIDEntry{realRoomID: realRoomID})
+	return realRoomID, nil
+}
+
+// 订阅房间事件。Since大于等于0时先补发该序号之后的事件，
+// 补发窗口已经滚过时先发送断档标记；否则按需先发送历史弹幕。
+// 相同延迟的订阅者共享同一个延迟队列。
+func (h *Hub) Join(roomID int, sub Subscriber, opts JoinOptions) (*Room, error) {
+	realRoomID, err := h.Check(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		h.mu.Lock()
+		room, ok := h.rooms[realRoomID]
+		if !ok {
+			room = newRoom(h, realRoomID)
+			h.rooms[realRoomID] = room
+			go room.run()
+		}
+		h.mu.Unlock()
+
+		// 等待首次连接B站的结果
+		<-room.ready
+		if room.startErr != nil {
+			return nil, &Error{Code: CodeUpstreamFailure, Message: room.startErr.Error()}
+		}
+		var history []*event.Event
+		if opts.Backfill && opts.Since < 0 && h.historyTTL > 0 {
+			history = room.history()
+		}
+		err := room.subscribe(sub, opts, history)
+		if err != errRoomClosed {
+			if err != nil {
+				return nil, err
+			}
+			return room, nil
+		}
+		// 房间恰好在保留期结束时关闭，重新创建
+	}
+}
+
+// 取消订阅
+func (h *Hub) Leave(room *Room, sub Subscriber) {
+	room.unsubscribe(sub)
+}
+
+// 查找已打开的房间，roomID为真实房间ID
+func (h *Hub) Lookup(roomID int) (*Room, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	room, ok := h.rooms[roomID]
+	return room, ok
+}
+
+// 当前所有房间
+func (h *Hub) Rooms() []*Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rooms := make([]*Room, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// 关闭房间并断开其所有订阅者，roomID为真实房间ID。
+// 之后再有客户端订阅时房间会重新创建，需要禁止订阅时应使用禁止列表。
+func (h *Hub) CloseRoom(roomID int) bool {
+	room, ok := h.Lookup(roomID)
+	if !ok {
+		return false
+	}
+
+	room.mu.Lock()
+	subs := make([]Subscriber, 0, len(room.subs))
+	for sub := range room.subs {
+		subs = append(subs, sub)
+	}
+	room.mu.Unlock()
+
+	log.Printf("房间 %d 被管理员关闭，断开 %d 个订阅者", roomID, len(subs))
+	room.close()
+	err := &Error{Code: CodeRoomClosed, Message: fmt.Sprintf("房间 %d 已被管理员关闭", roomID)}
+	for _, sub := range subs {
+		if k, ok := sub.(Kicker); ok {
+			k.Kick(err)
+		}
+	}
+	return true
+}
+
+// 重新获取buvid3后重连房间，弹幕服务器的token在每次连接时都会重新获取
+func (h *Hub) RefreshToken(roomID int) error {
+	room, ok := h.Lookup(roomID)
+	if !ok {
+		return &Error{Code: CodeRoomNotFound, Message: fmt.Sprintf("房间 %d 未打开", roomID)}
+	}
+	buvid3, err := api.GetRealBuvid3()
+	if err != nil {
+		return fmt.Errorf("获取Buvid3失败: %v", err)
+	}
+	config.SetBuvid3(buvid3)
+	if !room.Reconnect() {
+		return fmt.Errorf("房间 %d 正在重连", roomID)
+	}
+	return nil
+}
+
+// 关闭所有房间
+func (h *Hub) CloseAll() {
+	for _, room := range h.Rooms() {
+		room.close()
+	}
+}
+
+func (h *Hub) remove(room *Room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room.ID] == room {
+		delete(h.rooms, room.ID)
+	}
+}
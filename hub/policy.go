@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/FH-TianHe/BiliMux/config"
+)
+
+// 加入房间失败的错误码，为4000加上对应的HTTP状态码，
+// 同时用作WebSocket关闭码和模拟连接认证回复中的code
+const (
+	CodeRoomDenied      = 4000 + http.StatusForbidden          // 房间在禁止列表中或不在允许列表中
+	CodeRoomNotFound    = 4000 + http.StatusNotFound           // 无法解析房间号
+	CodeRoomFull        = 4000 + http.StatusServiceUnavailable // 房间的客户端数已达上限
+	CodeUpstreamFailure = 4000 + http.StatusBadGateway         // 无法连接B站
+	CodeRoomClosed      = 4000 + http.StatusGone               // 房间被管理员关闭
+)
+
+// 加入房间失败的原因
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// 对应的HTTP状态码
+func (e *Error) HTTPStatus() int {
+	return e.Code - 4000
+}
+
+// 检查房间是否允许订阅，返回真实房间ID。
+// 先按客户端给出的房间号检查禁止和允许列表，未通过的房间号不会请求B站；
+// 允许列表非空时只接受列表中的房间号及其对应的真实房间ID。
+// 禁止列表中的短号同样禁止其真实房间ID，反之亦然。
+func (h *Hub) Check(roomID int) (int, error) {
+	cfg := config.GetConfig()
+	denied := &Error{Code: CodeRoomDenied, Message: fmt.Sprintf("房间 %d 禁止订阅", roomID)}
+	if containsRoom(cfg.DeniedRooms, roomID, roomID) {
+		return 0, denied
+	}
+	if len(cfg.AllowedRooms) > 0 && !h.inList(cfg.AllowedRooms, roomID) {
+		return 0, &Error{Code: CodeRoomDenied, Message: fmt.Sprintf("房间 %d 不在允许列表中", roomID)}
+	}
+
+	realRoomID, err := h.ResolveRoomID(roomID)
+	if err != nil {
+		return 0, err
+	}
+	if containsRoom(cfg.DeniedRooms, roomID, realRoomID) || h.inList(cfg.DeniedRooms, realRoomID) {
+		return 0, denied
+	}
+	return realRoomID, nil
+}
+
+// 房间号是否在列表中，或是列表中某个房间的真实房间ID。
+// 只解析列表中的房间号，请求次数受配置大小限制。
+func (h *Hub) inList(list []int, roomID int) bool {
+	for _, id := range list {
+		if id == roomID {
+			return true
+		}
+	}
+	for _, id := range list {
+		if realRoomID, err := h.ResolveRoomID(id); err == nil && realRoomID == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRoom(list []int, roomID, realRoomID int) bool {
+	for _, id := range list {
+		if id == roomID || id == realRoomID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package hub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/manager"
+)
+
+// 加载房间限制。配置文件按字段覆盖已加载的配置，所以两个列表都要写出
+func setRoomLists(t *testing.T, allowed, denied []int) {
+	t.Helper()
+	if allowed == nil {
+		allowed = []int{}
+	}
+	if denied == nil {
+		denied = []int{}
+	}
+	data, err := json.Marshal(map[string][]int{"allowed_rooms": allowed, "denied_rooms": denied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 房间号已经解析过的hub，不会请求B站
+func testHub() *Hub {
+	h := New(manager.NewConnectionManager(10), Options{Linger: time.Minute})
+	h.roomIDs.set(1, roomIDEntry{realRoomID: 5440})
+	h.roomIDs.set(5440, roomIDEntry{realRoomID: 5440})
+	h.roomIDs.set(2, roomIDEntry{realRoomID: 6000})
+	h.roomIDs.set(6000, roomIDEntry{realRoomID: 6000})
+	h.roomIDs.set(7, roomIDEntry{realRoomID: 7})
+	h.roomIDs.set(404, roomIDEntry{err: &Error{Code: CodeRoomNotFound, Message: "房间不存在"}})
+	return h
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []int
+		denied   []int
+		roomID   int
+		want     int
+		wantCode int
+	}{
+		{"不限制时解析短号", nil, nil, 1, 5440, 0},
+		{"禁止短号", nil, []int{1}, 1, 0, CodeRoomDenied},
+		{"禁止短号时用真实ID连接", nil, []int{1}, 5440, 0, CodeRoomDenied},
+		{"禁止真实ID时用短号连接", nil, []int{5440}, 1, 0, CodeRoomDenied},
+		{"禁止其他房间", nil, []int{2}, 5440, 5440, 0},
+		{"禁止列表中有不存在的房间", nil, []int{404}, 7, 7, 0},
+		{"允许短号时用真实ID连接", []int{1}, nil, 5440, 5440, 0},
+		{"允许真实ID时用短号连接", []int{5440}, nil, 1, 0, CodeRoomDenied},
+		{"不在允许列表", []int{1}, nil, 2, 0, CodeRoomDenied},
+		{"禁止优先于允许", []int{1}, []int{5440}, 1, 0, CodeRoomDenied},
+		{"房间不存在", nil, nil, 404, 0, CodeRoomNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRoomLists(t, tt.allowed, tt.denied)
+			got, err := testHub().Check(tt.roomID)
+			if tt.wantCode != 0 {
+				e, ok := err.(*Error)
+				if !ok || e.Code != tt.wantCode {
+					t.Fatalf("Check(%d) err = %v, want code %d", tt.roomID, err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Check(%d) = %d, %v, want %d", tt.roomID, got, err, tt.want)
+			}
+		})
+	}
+}
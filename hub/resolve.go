@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// 房间号缓存的上限，超出时先淘汰过期的条目，再随机淘汰
+const maxResolvedRooms = 10000
+
+// 房间不存在的结果缓存的时间，避免反复用不存在的房间号请求B站
+const notFoundTTL = 5 * time.Minute
+
+// 短号到真实房间ID的缓存，容量有限，房间不存在的结果也会缓存一段时间
+type roomIDCache struct {
+	mu      sync.Mutex
+	entries map[int]roomIDEntry
+}
+
+type roomIDEntry struct {
+	realRoomID int
+	err        error     // 房间不存在时的错误
+	expires    time.Time // 为零表示不过期
+}
+
+func (c *roomIDCache) get(roomID int) (roomIDEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[roomID]
+	if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(c.entries, roomID)
+		return roomIDEntry{}, false
+	}
+	return e, ok
+}
+
+func (c *roomIDCache) set(roomID int, e roomIDEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[int]roomIDEntry)
+	}
+	if _, ok := c.entries[roomID]; !ok && len(c.entries) >= maxResolvedRooms {
+		c.evict()
+	}
+	c.entries[roomID] = e
+}
+
+// 调用时需持有锁
+func (c *roomIDCache) evict() {
+	now := time.Now()
+	for id, e := range c.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(c.entries, id)
+		}
+	}
+	for id := range c.entries {
+		if len(c.entries) < maxResolvedRooms {
+			break
+		}
+		delete(c.entries, id)
+	}
+}
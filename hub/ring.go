@@ -0,0 +1,43 @@
+package hub
+
+import "github.com/FH-TianHe/BiliMux/event"
+
+// 固定容量的事件环形缓冲区，写满后覆盖最旧的事件
+type ring struct {
+	buf   []*event.Event
+	start int
+	count int
+}
+
+func newRing(size int) *ring {
+	return &ring{buf: make([]*event.Event, size)}
+}
+
+func (r *ring) push(ev *event.Event) {
+	if len(r.buf) == 0 {
+		return
+	}
+	if r.count < len(r.buf) {
+		r.buf[(r.start+r.count)%len(r.buf)] = ev
+		r.count++
+		return
+	}
+	r.buf[r.start] = ev
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+func (r *ring) len() int {
+	return r.count
+}
+
+// 序号大于seq的事件，按序号顺序返回
+func (r *ring) since(seq uint64) []*event.Event {
+	var out []*event.Event
+	for i := 0; i < r.count; i++ {
+		ev := r.buf[(r.start+i)%len(r.buf)]
+		if ev.Seq > seq {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/FH-TianHe/BiliMux/event"
+)
+
+func seqs(events []*event.Event) []uint64 {
+	out := make([]uint64, 0, len(events))
+	for _, ev := range events {
+		out = append(out, ev.Seq)
+	}
+	return out
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRing(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		pushed  int
+		since   uint64
+		wantLen int
+		want    []uint64
+	}{
+		{"空", 3, 0, 0, 0, []uint64{}},
+		{"未写满", 3, 2, 0, 2, []uint64{1, 2}},
+		{"正好写满", 3, 3, 1, 3, []uint64{2, 3}},
+		{"覆盖最旧的事件", 3, 5, 0, 3, []uint64{3, 4, 5}},
+		{"多次绕回", 3, 10, 8, 3, []uint64{9, 10}},
+		{"没有更新的事件", 3, 5, 5, 3, []uint64{}},
+		{"容量为0", 0, 5, 0, 0, []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRing(tt.size)
+			for i := 1; i <= tt.pushed; i++ {
+				r.push(&event.Event{Seq: uint64(i)})
+			}
+			if r.len() != tt.wantLen {
+				t.Errorf("len = %d, want %d", r.len(), tt.wantLen)
+			}
+			if got := seqs(r.since(tt.since)); !equalSeqs(got, tt.want) {
+				t.Errorf("since(%d) = %v, want %v", tt.since, got, tt.want)
+			}
+		})
+	}
+}
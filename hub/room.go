@@ -0,0 +1,440 @@
+package hub
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/metrics"
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// 补发窗口已经滚过时发送的断档标记
+const GapCmd = "BILIMUX_GAP"
+
+// 房间已关闭，加入时需要重新创建
+var errRoomClosed = errors.New("房间已关闭")
+
+// 上游重连的最大退避时间
+const maxReconnectBackoff = 30 * time.Second
+
+// 房间：一条B站连接及其所有订阅者
+type Room struct {
+	ID  int // 真实房间ID
+	hub *Hub
+
+	ready    chan struct{} // 首次连接完成后关闭
+	startErr error
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	popularity uint32 // 最近一次心跳回复中的人气值
+
+	// 统计，房间重新创建后从零开始
+	messagesIn int64 // 收到的业务消息数
+	bytesIn    int64 // 收到的数据帧字节数
+	errors     int64
+	reconnects int64
+	rate       metrics.Rate // 每秒收到的业务消息数
+
+	lastHeartbeat int64 // 最近一次收到心跳回复的时间(Unix纳秒)
+	skipBackoff   int32 // 管理员要求重连时不等待退避时间
+
+	historyCache historyCache
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	hostURL   string
+	connected bool                      // 与B站的连接是否正常，重连期间为false
+	since     time.Time                 // 当前连接建立的时间
+	subs      map[Subscriber]*delayLine // 实时订阅者对应nil
+	delays    map[time.Duration]*delayLine
+	seq       uint64
+	replay    *ring
+	closed    bool
+	linger    *time.Timer
+}
+
+func newRoom(h *Hub, realRoomID int) *Room {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Room{
+		ID:     realRoomID,
+		hub:    h,
+		ready:  make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[Subscriber]*delayLine),
+		delays: make(map[time.Duration]*delayLine),
+		replay: newRing(h.replayWindow),
+	}
+}
+
+// 人气值，用于在本地应答客户端心跳
+func (r *Room) Popularity() uint32 {
+	return atomic.LoadUint32(&r.popularity)
+}
+
+// 房间状态
+type RoomInfo struct {
+	ID               int       `json:"room_id"`
+	Host             string    `json:"host"`
+	State            string    `json:"state"` // connected、reconnecting或closed
+	Connected        bool      `json:"connected"`
+	ConnectedAt      time.Time `json:"connected_at"`      // 当前B站连接建立的时间
+	ConnectedSeconds int64     `json:"connected_seconds"` // 当前B站连接的时长，断开时为0
+	Subscribers      int       `json:"subscribers"`
+	Seq              uint64    `json:"seq"`
+	Popularity       uint32    `json:"popularity"`
+	LastHeartbeat    time.Time `json:"last_heartbeat"` // 最近一次收到心跳回复的时间
+	MessagesIn       int64     `json:"messages_in"`
+	MessagesPerSec   float64   `json:"messages_per_sec"` // 最近10秒的平均值
+	BytesIn          int64     `json:"bytes_in"`
+	Errors           int64     `json:"errors"`
+	Reconnects       int64     `json:"reconnects"`
+}
+
+func (r *Room) Info() RoomInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := RoomInfo{
+		ID:             r.ID,
+		Host:           r.hostURL,
+		Connected:      r.connected,
+		ConnectedAt:    r.since,
+		Subscribers:    len(r.subs),
+		Seq:            r.seq,
+		Popularity:     r.Popularity(),
+		MessagesIn:     atomic.LoadInt64(&r.messagesIn),
+		MessagesPerSec: r.rate.PerSecond(),
+		BytesIn:        atomic.LoadInt64(&r.bytesIn),
+		Errors:         atomic.LoadInt64(&r.errors),
+		Reconnects:     atomic.LoadInt64(&r.reconnects),
+	}
+	switch {
+	case r.closed:
+		info.State = "closed"
+	case r.connected:
+		info.State = "connected"
+		info.ConnectedSeconds = int64(time.Since(r.since).Seconds())
+	default:
+		info.State = "reconnecting"
+	}
+	if ns := atomic.LoadInt64(&r.lastHeartbeat); ns != 0 {
+		info.LastHeartbeat = time.Unix(0, ns)
+	}
+	return info
+}
+
+// 记录房间的错误，同时计入全局错误数
+func (r *Room) incrementErrors() {
+	atomic.AddInt64(&r.errors, 1)
+	r.hub.cm.IncrementErrors()
+}
+
+// 连接B站并持续读取，连接断开后按退避时间重连，直到房间关闭
+func (r *Room) run() {
+	conn, hostURL, err := dial(r.ID)
+	if err != nil {
+		r.startErr = err
+		r.hub.remove(r)
+		close(r.ready)
+		return
+	}
+	close(r.ready)
+
+	backoff := time.Second
+	for {
+		if !r.setConn(conn, hostURL) {
+			conn.Close()
+			return
+		}
+		log.Printf("房间 %d 已连接B站服务器: %s", r.ID, hostURL)
+
+		go protocol.HandleHeartbeat(conn, r.hub.cm)
+		r.readLoop(conn)
+		r.setDisconnected()
+		conn.Close()
+
+		for {
+			if r.ctx.Err() != nil {
+				return
+			}
+			if atomic.SwapInt32(&r.skipBackoff, 0) == 0 {
+				log.Printf("房间 %d 与B站服务器断开，%v后重连", r.ID, backoff)
+				select {
+				case <-r.ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+			}
+
+			conn, hostURL, err = dial(r.ID)
+			metrics.Reconnect(err == nil)
+			atomic.AddInt64(&r.reconnects, 1)
+			if err == nil {
+				backoff = time.Second
+				break
+			}
+			log.Printf("房间 %d 重连失败: %v", r.ID, err)
+			r.incrementErrors()
+			if backoff *= 2; backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+		}
+	}
+}
+
+func (r *Room) setConn(conn *websocket.Conn, hostURL string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.conn, r.hostURL, r.connected, r.since = conn, hostURL, true, time.Now()
+	return true
+}
+
+func (r *Room) setDisconnected() {
+	r.mu.Lock()
+	r.connected = false
+	r.mu.Unlock()
+}
+
+func (r *Room) readLoop(conn *websocket.Conn) {
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		r.handleFrame(frame)
+	}
+}
+
+// 解码一帧数据，业务消息编号后广播给订阅者
+func (r *Room) handleFrame(frame []byte) {
+	metrics.FrameIn(len(frame))
+	atomic.AddInt64(&r.bytesIn, int64(len(frame)))
+	packets, err := protocol.SplitPackets(frame)
+	if err != nil {
+		log.Printf("房间 %d 解析数据包失败: %v", r.ID, err)
+		r.incrementErrors()
+		return
+	}
+
+	var events []*event.Event
+	for _, p := range packets {
+		switch p.Header.Operation {
+		case protocol.OpMessage:
+			msg, err := protocol.ParseMessage(p.Body)
+			if err != nil {
+				r.incrementErrors()
+				continue
+			}
+			metrics.MessageIn(msg.Cmd, len(p.Body))
+			atomic.AddInt64(&r.messagesIn, 1)
+			r.rate.Add(1)
+			events = append(events, event.FromMessage(r.ID, msg))
+		case protocol.OpHeartbeatReply:
+			atomic.StoreInt64(&r.lastHeartbeat, time.Now().UnixNano())
+			if len(p.Body) >= 4 {
+				atomic.StoreUint32(&r.popularity, binary.BigEndian.Uint32(p.Body))
+			}
+		case protocol.OpAuthReply:
+			var reply struct {
+				Code int `json:"code"`
+			}
+			if json.Unmarshal(p.Body, &reply) == nil && reply.Code != 0 {
+				log.Printf("房间 %d 认证失败: %d", r.ID, reply.Code)
+			}
+		}
+	}
+
+	if len(events) > 0 {
+		version, upstream := passthrough(frame, len(packets), len(events))
+		event.NewBatch(events, version, upstream)
+		r.broadcast(events)
+	}
+}
+
+// 帧是单个压缩数据包且其中全部是业务消息时，可以原样转发给压缩版本相同的客户端
+func passthrough(frame []byte, packets, events int) (uint16, []byte) {
+	header, _, err := protocol.ParseHeader(frame)
+	if err != nil || int(header.PacketLength) != len(frame) || packets != events {
+		return 0, nil
+	}
+	if header.Operation != protocol.OpMessage || (header.Version != protocol.VersionZlib && header.Version != protocol.VersionBrotli) {
+		return 0, nil
+	}
+	return header.Version, frame
+}
+
+// 为事件编号、写入补发窗口并发送给所有订阅者
+func (r *Room) broadcast(events []*event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ev := range events {
+		r.seq++
+		ev.Seq = r.seq
+		r.replay.push(ev)
+	}
+	for sub, line := range r.subs {
+		if line == nil {
+			sub.Deliver(events)
+		}
+	}
+	for _, line := range r.delays {
+		line.push(events)
+	}
+}
+
+// 加入订阅者，补发和加入在同一把锁内完成，保证事件不重不漏。
+// 历史弹幕在实时事件之前发送；延迟大于0时订阅者加入对应的延迟队列。
+func (r *Room) subscribe(sub Subscriber, opts JoinOptions, history []*event.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errRoomClosed
+	}
+	if max := config.GetConfig().MaxClientsPerRoom; max > 0 && len(r.subs) >= max {
+		return &Error{Code: CodeRoomFull, Message: fmt.Sprintf("房间 %d 的客户端数已达上限", r.ID)}
+	}
+	if _, ok := r.delays[opts.Delay]; opts.Delay > 0 && !ok && len(r.delays) >= maxDelayLines {
+		return &Error{Code: CodeRoomFull, Message: fmt.Sprintf("房间 %d 的延迟队列数已达上限", r.ID)}
+	}
+	if r.linger != nil {
+		r.linger.Stop()
+		r.linger = nil
+	}
+	if len(history) > 0 {
+		sub.Deliver(history)
+	}
+
+	if opts.Delay <= 0 {
+		if opts.Since >= 0 {
+			if backlog := r.backlog(uint64(opts.Since), r.seq); len(backlog) > 0 {
+				sub.Deliver(backlog)
+			}
+		}
+		r.subs[sub] = nil
+		return nil
+	}
+
+	line, ok := r.delays[opts.Delay]
+	if !ok {
+		line = newDelayLine(r, opts.Delay)
+		r.delays[opts.Delay] = line
+	}
+	// 续传时只补发延迟队列已经发送过的事件，其余的随队列到期发送
+	line.mu.Lock()
+	if opts.Since >= 0 {
+		if backlog := r.backlog(uint64(opts.Since), line.lastSeq); len(backlog) > 0 {
+			sub.Deliver(backlog)
+		}
+	}
+	line.subs[sub] = struct{}{}
+	line.mu.Unlock()
+	r.subs[sub] = line
+	return nil
+}
+
+// 序号在(since, upto]之间的事件，调用时需持有锁
+func (r *Room) backlog(since, upto uint64) []*event.Event {
+	// 序号比当前还大，说明房间已重建，序号从头开始
+	if since > r.seq {
+		return []*event.Event{event.Notice(r.ID, GapCmd, map[string]interface{}{
+			"reset": true,
+			"seq":   r.seq,
+		})}
+	}
+
+	var out []*event.Event
+	first := r.seq - uint64(r.replay.len()) + 1
+	if since+1 < first {
+		out = append(out, event.Notice(r.ID, GapCmd, map[string]interface{}{
+			"from": since + 1,
+			"to":   first - 1,
+		}))
+	}
+	for _, ev := range r.replay.since(since) {
+		if ev.Seq > upto {
+			break
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+// 移除订阅者，最后一个订阅者离开后房间保留一段时间以便客户端续传
+func (r *Room) unsubscribe(sub Subscriber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if line := r.subs[sub]; line != nil && line.remove(sub) {
+		line.close()
+		delete(r.delays, line.delay)
+	}
+	delete(r.subs, sub)
+	if len(r.subs) == 0 && !r.closed && r.linger == nil {
+		r.linger = time.AfterFunc(r.hub.linger, r.expire)
+	}
+}
+
+// 断开当前的B站连接并立即重连，重连时会重新获取弹幕服务器和token。
+// 正在重连时返回false。
+func (r *Room) Reconnect() bool {
+	r.mu.Lock()
+	conn, connected := r.conn, r.connected
+	r.mu.Unlock()
+	if !connected {
+		return false
+	}
+	atomic.StoreInt32(&r.skipBackoff, 1)
+	log.Printf("房间 %d 按管理员要求重连", r.ID)
+	conn.Close()
+	return true
+}
+
+// 保留期结束时仍没有订阅者则关闭房间
+func (r *Room) expire() {
+	r.hub.mu.Lock()
+	r.mu.Lock()
+	if len(r.subs) > 0 || r.closed {
+		r.mu.Unlock()
+		r.hub.mu.Unlock()
+		return
+	}
+	if r.hub.rooms[r.ID] == r {
+		delete(r.hub.rooms, r.ID)
+	}
+	r.mu.Unlock()
+	r.hub.mu.Unlock()
+
+	log.Printf("房间 %d 已无客户端，关闭B站连接", r.ID)
+	r.close()
+}
+
+// 关闭房间及其B站连接
+func (r *Room) close() {
+	r.mu.Lock()
+	r.closed = true
+	conn := r.conn
+	for _, line := range r.delays {
+		line.close()
+	}
+	r.mu.Unlock()
+
+	r.hub.remove(r)
+	r.cancel()
+	if conn != nil {
+		conn.Close()
+	}
+}
@@ -0,0 +1,150 @@
+package hub
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// 记录收到的事件的订阅者
+type recorder struct {
+	mu     sync.Mutex
+	events []*event.Event
+}
+
+func (r *recorder) Deliver(events []*event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, events...)
+}
+
+func (r *recorder) received() []*event.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*event.Event(nil), r.events...)
+}
+
+// 不连接B站的房间，只用于测试编号、补发和延迟
+func testRoom(replayWindow int) *Room {
+	h := New(manager.NewConnectionManager(10), Options{ReplayWindow: replayWindow, Linger: time.Minute})
+	return newRoom(h, 1)
+}
+
+func broadcastN(r *Room, n int) {
+	for i := 0; i < n; i++ {
+		r.broadcast([]*event.Event{{Cmd: "DANMU_MSG", RoomID: r.ID, Time: time.Now().UnixMilli()}})
+	}
+}
+
+func TestRoomBacklog(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    int
+		broadcast int
+		since     int64
+		wantGap   map[string]interface{} // 为nil时没有断档标记
+		wantSeqs  []uint64
+	}{
+		{"不续传", 5, 3, -1, nil, []uint64{}},
+		{"已是最新", 5, 3, 3, nil, []uint64{}},
+		{"补发窗口内", 5, 3, 1, nil, []uint64{2, 3}},
+		{"从头补发", 5, 3, 0, nil, []uint64{1, 2, 3}},
+		{"窗口已经滚过", 3, 10, 2, map[string]interface{}{"from": uint64(3), "to": uint64(7)}, []uint64{8, 9, 10}},
+		{"房间已重建", 5, 3, 100, map[string]interface{}{"reset": true, "seq": uint64(3)}, []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRoom(tt.window)
+			broadcastN(r, tt.broadcast)
+
+			sub := &recorder{}
+			if err := r.subscribe(sub, JoinOptions{Since: tt.since}, nil); err != nil {
+				t.Fatal(err)
+			}
+			got := sub.received()
+			if tt.wantGap != nil {
+				if len(got) == 0 || got[0].Cmd != GapCmd {
+					t.Fatalf("第一个事件不是断档标记: %v", got)
+				}
+				data := got[0].Data.(map[string]interface{})
+				for k, v := range tt.wantGap {
+					if data[k] != v {
+						t.Errorf("断档标记 %s = %v, want %v", k, data[k], v)
+					}
+				}
+				got = got[1:]
+			}
+			if s := seqs(got); !equalSeqs(s, tt.wantSeqs) {
+				t.Errorf("补发 %v, want %v", s, tt.wantSeqs)
+			}
+
+			// 加入后的实时事件不重不漏
+			broadcastN(r, 1)
+			all := sub.received()
+			if last := all[len(all)-1]; last.Seq != uint64(tt.broadcast+1) {
+				t.Errorf("实时事件序号 = %d, want %d", last.Seq, tt.broadcast+1)
+			}
+		})
+	}
+}
+
+func TestRoomSubscribeHistoryFirst(t *testing.T) {
+	r := testRoom(5)
+	broadcastN(r, 2)
+	sub := &recorder{}
+	history := []*event.Event{{Cmd: "DANMU_MSG", Backfill: true}}
+	if err := r.subscribe(sub, JoinOptions{Since: 0}, history); err != nil {
+		t.Fatal(err)
+	}
+	got := sub.received()
+	if len(got) != 3 || !got[0].Backfill || got[1].Seq != 1 || got[2].Seq != 2 {
+		t.Errorf("收到 %v，历史弹幕应在补发事件之前", seqs(got))
+	}
+}
+
+func TestRoomSubscribeClosed(t *testing.T) {
+	r := testRoom(5)
+	r.closed = true
+	if err := r.subscribe(&recorder{}, JoinOptions{Since: -1}, nil); err != errRoomClosed {
+		t.Errorf("err = %v, want errRoomClosed", err)
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	msg := protocol.EncodePacket(protocol.OpMessage, protocol.VersionPlain, []byte(`{"cmd":"DANMU_MSG"}`))
+	compress := func(version uint16) []byte {
+		frame, err := protocol.CompressPackets(msg, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return frame
+	}
+	brotli := compress(protocol.VersionBrotli)
+
+	tests := []struct {
+		name        string
+		frame       []byte
+		packets     int
+		events      int
+		wantVersion uint16
+		wantFrame   bool
+	}{
+		{"brotli压缩帧", brotli, 1, 1, protocol.VersionBrotli, true},
+		{"zlib压缩帧", compress(protocol.VersionZlib), 1, 1, protocol.VersionZlib, true},
+		{"有消息解析失败", brotli, 2, 1, 0, false},
+		{"未压缩的帧", msg, 1, 1, 0, false},
+		{"多个数据包", append(append([]byte(nil), brotli...), brotli...), 2, 2, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, frame := passthrough(tt.frame, tt.packets, tt.events)
+			if (frame != nil) != tt.wantFrame || version != tt.wantVersion {
+				t.Errorf("passthrough = %d, %v, want %d, %v", version, frame != nil, tt.wantVersion, tt.wantFrame)
+			}
+		})
+	}
+}
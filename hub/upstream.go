@@ -0,0 +1,49 @@
+package hub
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/api"
+	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/protocol"
+)
+
+// 连接到B站弹幕服务器并发送认证包
+func dial(realRoomID int) (*websocket.Conn, string, error) {
+	// 获取弹幕信息
+	token, hosts, err := api.GetDanmuInfo(realRoomID)
+	if err != nil {
+		return nil, "", fmt.Errorf("获取弹幕信息失败: %v", err)
+	}
+	if len(hosts) == 0 {
+		return nil, "", fmt.Errorf("获取弹幕信息失败: 没有可用的服务器")
+	}
+
+	// 随机选择一个服务器
+	host := hosts[rand.Intn(len(hosts))]
+	hostURL := fmt.Sprintf("wss://%s:%v/sub", host["host"], host["wss_port"])
+
+	conn, _, err := websocket.DefaultDialer.Dial(hostURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("连接B站服务器失败: %v", err)
+	}
+
+	// 创建认证包
+	buvid3 := config.GetConfig().Buvid3
+	authPacket, err := protocol.CreateAuthPacket(realRoomID, token, buvid3)
+	if err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("创建认证包失败: %v", err)
+	}
+
+	// 发送认证包
+	if err := conn.WriteMessage(websocket.BinaryMessage, authPacket); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("发送认证包失败: %v", err)
+	}
+
+	return conn, hostURL, nil
+}
@@ -0,0 +1,178 @@
+package limit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// 统计子网连接数时使用的前缀长度
+const (
+	subnetBitsV4 = 24
+	subnetBitsV6 = 64
+)
+
+var (
+	trustedProxies []*net.IPNet
+
+	perIPConns     = 0 // 单个IP的最大并发连接数，0表示不限制
+	perSubnetConns = 0 // 单个子网的最大并发连接数，0表示不限制
+	connRate       *bucketSet
+	loginRate      *bucketSet
+
+	mu      sync.Mutex
+	ips     = make(map[string]int)
+	subnets = make(map[string]int)
+)
+
+// 设置受信任的反向代理，逗号分隔的IP或CIDR
+func SetTrustedProxies(list string) error {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("无效的代理地址: %s", s)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// 设置单IP和单子网的并发连接上限，以及单IP新建连接的速率(个/秒)
+func SetConnLimits(perIP, perSubnet int, rate float64, burst int) error {
+	if perIP < 0 || perSubnet < 0 || rate < 0 || burst < 0 {
+		return fmt.Errorf("连接限制不能为负数")
+	}
+	perIPConns, perSubnetConns = perIP, perSubnet
+	connRate = newBucketSet(rate, burst)
+	return nil
+}
+
+// 设置单IP登录请求的速率(次/分钟)
+func SetLoginRate(perMinute float64, burst int) error {
+	if perMinute < 0 || burst < 0 {
+		return fmt.Errorf("登录限制不能为负数")
+	}
+	loginRate = newBucketSet(perMinute/60, burst)
+	return nil
+}
+
+// 客户端IP。直连地址是受信任的代理时，从X-Forwarded-For中由右向左
+// 取第一个不受信任的地址
+func ClientIP(r *http.Request) string {
+	ip := hostOnly(r.RemoteAddr)
+	if !trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// 去掉地址中的端口
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// 从net.Addr取出IP
+func AddrIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return hostOnly(addr.String())
+}
+
+func trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// 为新连接占用名额，超出速率或并发上限时返回原因。成功后需调用Close释放
+func Open(ip string) error {
+	if !connRate.allow(ip) {
+		return fmt.Errorf("新建连接过于频繁")
+	}
+
+	subnet := subnetOf(ip)
+	mu.Lock()
+	defer mu.Unlock()
+	if perIPConns > 0 && ips[ip] >= perIPConns {
+		return fmt.Errorf("该IP的连接数已达上限")
+	}
+	if perSubnetConns > 0 && subnets[subnet] >= perSubnetConns {
+		return fmt.Errorf("该子网的连接数已达上限")
+	}
+	ips[ip]++
+	subnets[subnet]++
+	return nil
+}
+
+// 释放Open占用的名额
+func Close(ip string) {
+	subnet := subnetOf(ip)
+	mu.Lock()
+	defer mu.Unlock()
+	if ips[ip]--; ips[ip] <= 0 {
+		delete(ips, ip)
+	}
+	if subnets[subnet]--; subnets[subnet] <= 0 {
+		delete(subnets, subnet)
+	}
+}
+
+func subnetOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(subnetBitsV4, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(subnetBitsV6, 128)).String()
+}
+
+// 限制单IP申请登录的速率。轮询登录结果的请求很频繁，不应使用该限制
+func Login(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !loginRate.allow(ClientIP(r)) {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "登录请求过于频繁", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,144 @@
+package limit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := SetTrustedProxies("10.0.0.1, 192.168.0.0/16,::1"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies("")
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"直连", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"不受信任的直连忽略XFF", "203.0.113.5:1234", []string{"1.2.3.4"}, "203.0.113.5"},
+		{"受信任的代理", "10.0.0.1:80", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"取最右侧不受信任的地址", "10.0.0.1:80", []string{"6.6.6.6, 1.2.3.4, 192.168.1.1"}, "1.2.3.4"},
+		{"伪造的XFF被忽略", "10.0.0.1:80", []string{"127.0.0.1", "1.2.3.4"}, "1.2.3.4"},
+		{"多个XFF头按顺序拼接", "10.0.0.1:80", []string{"1.2.3.4", "192.168.1.1"}, "1.2.3.4"},
+		{"全部是受信任的代理", "10.0.0.1:80", []string{"192.168.1.2"}, "192.168.1.2"},
+		{"没有XFF", "10.0.0.1:80", nil, "10.0.0.1"},
+		{"无效地址时停止", "10.0.0.1:80", []string{"1.2.3.4, unknown"}, "10.0.0.1"},
+		{"IPv6代理", "[::1]:80", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"子网中的代理", "192.168.5.5:80", []string{"1.2.3.4"}, "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxiesInvalid(t *testing.T) {
+	defer SetTrustedProxies("")
+	for _, list := range []string{"10.0.0.256", "example.com", "10.0.0.0/33"} {
+		if err := SetTrustedProxies(list); err == nil {
+			t.Errorf("SetTrustedProxies(%q) 应返回错误", list)
+		}
+	}
+}
+
+func TestSubnetOf(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"1.2.3.4", "1.2.3.0"},
+		{"1.2.3.255", "1.2.3.0"},
+		{"::ffff:1.2.3.4", "1.2.3.0"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::"},
+		{"not-an-ip", "not-an-ip"},
+	}
+	for _, tt := range tests {
+		if got := subnetOf(tt.ip); got != tt.want {
+			t.Errorf("subnetOf(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestOpenLimits(t *testing.T) {
+	defer SetConnLimits(0, 0, 0, 0)
+
+	type step struct {
+		ip      string
+		close   bool // 为true时释放该IP的一个名额
+		wantErr bool
+	}
+	tests := []struct {
+		name      string
+		perIP     int
+		perSubnet int
+		steps     []step
+	}{
+		{"不限制", 0, 0, []step{{"1.1.1.1", false, false}, {"1.1.1.1", false, false}, {"1.1.1.1", false, false}}},
+		{"单IP上限", 2, 0, []step{{"1.1.1.1", false, false}, {"1.1.1.1", false, false}, {"1.1.1.1", false, true}, {"1.1.1.2", false, false}}},
+		{"释放后可再次连接", 1, 0, []step{{"1.1.1.1", false, false}, {"1.1.1.1", false, true}, {"1.1.1.1", true, false}, {"1.1.1.1", false, true}}},
+		{"子网上限", 0, 2, []step{{"1.1.1.1", false, false}, {"1.1.1.2", false, false}, {"1.1.1.3", false, true}, {"1.1.2.1", false, false}}},
+		{"IPv6按/64计算", 0, 1, []step{{"2001:db8::1", false, false}, {"2001:db8::2", false, true}, {"2001:db8:0:1::1", false, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetConnLimits(tt.perIP, tt.perSubnet, 0, 0); err != nil {
+				t.Fatal(err)
+			}
+			var opened []string
+			defer func() {
+				for _, ip := range opened {
+					Close(ip)
+				}
+			}()
+			for i, s := range tt.steps {
+				if s.close {
+					Close(s.ip)
+					opened = opened[:len(opened)-1]
+				}
+				err := Open(s.ip)
+				if (err != nil) != s.wantErr {
+					t.Fatalf("步骤 %d Open(%s) err = %v, wantErr %v", i, s.ip, err, s.wantErr)
+				}
+				if err == nil {
+					opened = append(opened, s.ip)
+				}
+			}
+		})
+	}
+	if len(ips) != 0 || len(subnets) != 0 {
+		t.Errorf("全部释放后仍有计数: %v %v", ips, subnets)
+	}
+}
+
+func TestOpenRate(t *testing.T) {
+	if err := SetConnLimits(0, 0, 0.001, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer SetConnLimits(0, 0, 0, 0)
+
+	for i, want := range []bool{true, true, false} {
+		err := Open("9.9.9.9")
+		if (err == nil) != want {
+			t.Errorf("第 %d 次 Open err = %v", i+1, err)
+		}
+		if err == nil {
+			defer Close("9.9.9.9")
+		}
+	}
+	if err := Open("9.9.9.8"); err != nil {
+		t.Errorf("其他IP不受影响: %v", err)
+	} else {
+		Close("9.9.9.8")
+	}
+}
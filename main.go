@@ -2,27 +2,65 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/FH-TianHe/BiliMux/auth"
+	"github.com/FH-TianHe/BiliMux/certs"
 	"github.com/FH-TianHe/BiliMux/config"
 	"github.com/FH-TianHe/BiliMux/handlers"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/limit"
 	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/rpc"
+	"github.com/FH-TianHe/BiliMux/tenant"
 	"github.com/FH-TianHe/BiliMux/utils"
 )
 
 var (
-	proxyAddr  = flag.String("proxy", "localhost:8080", "代理服务器监听地址")
-	statsPort  = flag.Int("stats", 8081, "统计服务端口")
-	maxConns   = flag.Int("max-conns", 1000, "最大并发连接数")
-	configFile = flag.String("config", "config/config.json", "配置文件路径")
+	proxyAddr      = flag.String("proxy", "localhost:8080", "代理服务器监听地址")
+	statsPort      = flag.Int("stats", 8081, "统计服务端口")
+	maxConns       = flag.Int("max-conns", 1000, "最大并发连接数")
+	configFile     = flag.String("config", "config/config.json", "配置文件路径")
+	sendQueue      = flag.Int("send-queue", 256, "每个客户端的发送队列长度")
+	slowPolicy     = flag.String("slow-policy", "drop-oldest", "发送队列溢出策略: drop-oldest, drop-newest, disconnect")
+	clientRate     = flag.Int("client-rate", 0, "客户端默认的普通弹幕速率限制(条/秒)，0表示不限制")
+	compressLvl    = flag.Int("compress-level", 0, "发往客户端的permessage-deflate压缩级别(1-9)，0表示不压缩")
+	compressMin    = flag.Int("compress-min", 256, "小于该字节数的消息不压缩")
+	pingEvery      = flag.Duration("ping-interval", 30*time.Second, "向客户端发送ping的间隔")
+	idleTimeout    = flag.Duration("idle-timeout", 90*time.Second, "客户端空闲超时，0表示不检测")
+	replaySize     = flag.Int("replay-window", 1000, "每个房间保留用于断线续传的事件数")
+	roomLinger     = flag.Duration("room-linger", time.Minute, "最后一个客户端离开后房间保留的时间")
+	maxDelay       = flag.Duration("max-delay", 5*time.Minute, "客户端可请求的最大延迟")
+	tcpAddr        = flag.String("tcp", "", "B站TCP协议监听地址，如:2243，为空时不开启")
+	grpcAddr       = flag.String("grpc", "", "gRPC服务监听地址，如:9090，为空时不开启")
+	admitWait      = flag.Duration("admission-wait", 0, "连接数达到上限时新客户端最多等待的时间，0表示直接拒绝")
+	admitQueue     = flag.Int("admission-queue", 100, "同时等待连接名额的客户端数上限")
+	trustedProxies = flag.String("trusted-proxies", "", "受信任的反向代理IP或CIDR，逗号分隔，来自这些地址的请求使用X-Forwarded-For")
+	perIPConns     = flag.Int("per-ip-conns", 0, "单个IP的最大并发连接数，0表示不限制")
+	perSubnetConns = flag.Int("per-subnet-conns", 0, "单个子网(IPv4 /24, IPv6 /64)的最大并发连接数，0表示不限制")
+	connRate       = flag.Float64("conn-rate", 0, "单个IP每秒新建连接数，0表示不限制")
+	connBurst      = flag.Int("conn-burst", 10, "单个IP新建连接的突发数")
+	loginRate      = flag.Float64("login-rate", 10, "单个IP每分钟申请登录二维码的次数，0表示不限制")
+	usageFile      = flag.String("usage-file", "config/usage.json", "租户用量文件路径")
+	usageInterval  = flag.Duration("usage-save-interval", time.Minute, "保存租户用量的间隔，0表示只在退出时保存")
+	historyTTL     = flag.Duration("history-ttl", 30*time.Second, "历史弹幕的缓存时间，0表示不补发历史弹幕")
+	tlsCert        = flag.String("tls-cert", "", "TLS证书文件，与tls-key同时设置时使用HTTPS和WSS")
+	tlsKey         = flag.String("tls-key", "", "TLS私钥文件")
+	tlsReload      = flag.Duration("tls-reload", time.Minute, "检查证书文件是否更新的间隔，0表示不重新加载")
+	statsTLS       = flag.Bool("stats-tls", false, "统计服务也使用TLS")
 )
 
 func main() {
@@ -33,42 +71,173 @@ func main() {
 	if err := config.LoadConfig(*configFile); err != nil {
 		log.Fatalf("加载配置文件失败: %v", err)
 	}
+	if !auth.Enabled() {
+		log.Println("警告: 未配置API密钥或JWT密钥，所有接口无需认证，管理操作已禁用")
+	}
+	for _, k := range config.GetConfig().APIKeys {
+		if !auth.ValidRole(k.Role) {
+			log.Printf("警告: API密钥 %s 的角色 %q 无效，只能订阅", k.Name, k.Role)
+		}
+	}
+	if err := tenant.Load(*usageFile); err != nil {
+		log.Fatalf("加载租户用量失败: %v", err)
+	}
+	go tenant.Persist(*usageFile, *usageInterval)
+	if len(config.GetConfig().AllowedOrigins) == 0 {
+		log.Println("警告: 未配置允许的来源，任何网站都可以连接")
+	}
+
+	if err := handlers.SetSendQueue(*sendQueue, *slowPolicy); err != nil {
+		log.Fatalf("发送队列配置错误: %v", err)
+	}
+	handlers.SetClientRate(*clientRate)
+	if err := handlers.SetCompression(*compressLvl, *compressMin); err != nil {
+		log.Fatalf("压缩配置错误: %v", err)
+	}
+	if err := handlers.SetLiveness(*pingEvery, *idleTimeout); err != nil {
+		log.Fatalf("存活检测配置错误: %v", err)
+	}
+	if err := handlers.SetMaxDelay(*maxDelay); err != nil {
+		log.Fatalf("延迟配置错误: %v", err)
+	}
+	if err := handlers.SetAdmission(*admitWait, *admitQueue); err != nil {
+		log.Fatalf("排队配置错误: %v", err)
+	}
+	if err := limit.SetTrustedProxies(*trustedProxies); err != nil {
+		log.Fatalf("代理配置错误: %v", err)
+	}
+	if err := limit.SetConnLimits(*perIPConns, *perSubnetConns, *connRate, *connBurst); err != nil {
+		log.Fatalf("连接限制配置错误: %v", err)
+	}
+	if err := limit.SetLoginRate(*loginRate, 3); err != nil {
+		log.Fatalf("登录限制配置错误: %v", err)
+	}
 
 	log.Printf("启动B站直播间WebSocket代理服务器: %s (最大连接数: %d)", *proxyAddr, *maxConns)
 
 	cm := manager.NewConnectionManager(*maxConns)
-	defer cm.CloseAll()
+
+	rooms := hub.New(cm, hub.Options{
+		ReplayWindow: *replaySize,
+		Linger:       *roomLinger,
+		HistoryTTL:   *historyTTL,
+	})
 
 	// 启动清理过期会话的goroutine
 	go utils.CleanExpiredSessions()
 
+	// 可选的TLS，证书文件更新后自动重新加载
+	var tlsConfig *tls.Config
+	if *tlsCert != "" || *tlsKey != "" {
+		if *tlsCert == "" || *tlsKey == "" {
+			log.Fatal("tls-cert和tls-key需要同时设置")
+		}
+		reloader, err := certs.NewReloader(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("加载TLS证书失败: %v", err)
+		}
+		go reloader.Watch(*tlsReload)
+		tlsConfig = reloader.TLSConfig()
+		log.Printf("已启用TLS，客户端使用wss://%s连接", *proxyAddr)
+	} else if *statsTLS {
+		log.Fatal("stats-tls需要设置tls-cert和tls-key")
+	}
+
 	// 启动统计服务
 	go func() {
 		statsMux := http.NewServeMux()
-		statsMux.HandleFunc("/stats", handlers.StatsHandler(cm))
+		statsMux.HandleFunc("/stats", auth.CORS(auth.RequireRole(auth.RoleViewer, handlers.StatsHandler(cm))))
+		statsMux.HandleFunc("/stats/rooms", auth.CORS(auth.RequireRole(auth.RoleViewer, handlers.RoomStatsHandler(rooms))))
+		statsMux.HandleFunc("/stats/clients", auth.CORS(auth.RequireRole(auth.RoleViewer, handlers.ClientStatsHandler(cm))))
+		statsMux.HandleFunc("/metrics", auth.CORS(auth.RequireRole(auth.RoleViewer, handlers.MetricsHandler(cm, rooms))))
+		statsMux.HandleFunc("/admin/tenants", auth.CORS(auth.RequireRole(auth.RoleViewer, handlers.TenantsHandler())))
+		statsMux.HandleFunc("/admin/clients", auth.CORS(auth.RequireRole(auth.RoleViewer, handlers.AdminClientsHandler(cm))))
+		statsMux.HandleFunc("/admin/clients/disconnect", auth.CORS(auth.RequireRole(auth.RoleOperator, handlers.DisconnectClientHandler(cm))))
+		statsMux.HandleFunc("/admin/upstreams", auth.CORS(auth.RequireRole(auth.RoleViewer, handlers.AdminUpstreamsHandler(rooms))))
+		statsMux.HandleFunc("/admin/upstreams/reconnect", auth.CORS(auth.RequireRole(auth.RoleOperator, handlers.ReconnectUpstreamHandler(rooms))))
+		statsMux.HandleFunc("/admin/upstreams/refresh", auth.CORS(auth.RequireRole(auth.RoleOperator, handlers.RefreshUpstreamHandler(rooms))))
+		statsMux.HandleFunc("/admin/rooms/close", auth.CORS(auth.RequireRole(auth.RoleAdmin, handlers.CloseRoomHandler(rooms))))
+		statsMux.HandleFunc("/admin/denials", auth.CORS(auth.RequireRole(auth.RoleAdmin, handlers.DenialsHandler())))
+		statsServer := &http.Server{
+			Addr:    fmt.Sprintf(":%d", *statsPort),
+			Handler: statsMux,
+		}
+		if *statsTLS {
+			statsServer.TLSConfig = tlsConfig
+			log.Printf("启动统计服务: https://localhost:%d/stats", *statsPort)
+			log.Fatal(statsServer.ListenAndServeTLS("", ""))
+		}
 		log.Printf("启动统计服务: http://localhost:%d/stats", *statsPort)
-		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *statsPort), statsMux))
+		log.Fatal(statsServer.ListenAndServe())
 	}()
 
-	// 添加扫码登录路由
-	http.HandleFunc("/login/qrcode", handlers.QRCodeHandler)
-	http.HandleFunc("/login/check", handlers.CheckLoginHandler)
+	// 添加扫码登录路由，登录会替换转发使用的B站账号
+	// 未开启认证时扫码登录与之前一样无需认证，开启后需要operator角色
+	loginRole := auth.RoleOperator
+	if !auth.Enabled() {
+		loginRole = auth.RoleViewer
+	}
+	http.HandleFunc("/login/qrcode", auth.CORS(limit.Login(auth.RequireRole(loginRole, handlers.QRCodeHandler))))
+	http.HandleFunc("/login/check", auth.CORS(auth.RequireRole(loginRole, handlers.CheckLoginHandler)))
+
+	// 弹幕服务器模拟，兼容直接连接B站弹幕服务器的现有工具。
+	// 与TCP客户端一样使用认证包中的key认证，也可以在请求头或查询参数中提供凭证
+	http.HandleFunc("/sub", auth.CORS(handlers.EmulateHandler(cm, rooms)))
 
 	// 主代理服务
-	http.HandleFunc("/", handlers.ProxyHandler(cm))
+	http.HandleFunc("/", auth.CORS(auth.Require(handlers.ProxyHandler(cm, rooms))))
 
 	// 启动HTTP服务器
 	server := &http.Server{
-		Addr:    *proxyAddr,
-		Handler: nil,
+		Addr:      *proxyAddr,
+		Handler:   nil,
+		TLSConfig: tlsConfig,
 	}
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP服务器启动失败: %v", err)
 		}
 	}()
 
+	// 按B站TCP协议服务不支持WebSocket的客户端
+	var tcpListener net.Listener
+	if *tcpAddr != "" {
+		ln, err := net.Listen("tcp", *tcpAddr)
+		if err != nil {
+			log.Fatalf("TCP监听失败: %v", err)
+		}
+		tcpListener = ln
+		log.Printf("启动TCP服务: %s", *tcpAddr)
+		go func() {
+			if err := handlers.ServeTCP(ln, cm, rooms); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("TCP服务失败: %v", err)
+			}
+		}()
+	}
+
+	// gRPC服务，与HTTP服务共享房间
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		ln, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("gRPC监听失败: %v", err)
+		}
+		grpcServer = rpc.NewServer(cm, rooms)
+		log.Printf("启动gRPC服务: %s", *grpcAddr)
+		go func() {
+			if err := grpcServer.Serve(ln); err != nil {
+				log.Fatalf("gRPC服务失败: %v", err)
+			}
+		}()
+	}
+
 	// 等待中断信号
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -77,11 +246,28 @@ func main() {
 	log.Println("接收到中断信号，关闭服务器...")
 
 	// 优雅关闭
+	if tcpListener != nil {
+		tcpListener.Close()
+	}
+	if grpcServer != nil {
+		// 订阅是长连接，不等待其结束
+		grpcServer.Stop()
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("服务器关闭失败: %v", err)
 	}
 
+	// 断开所有客户端并等待其退出，退还的额度和最后发送的字节数计入用量后再保存
+	rooms.CloseAll()
+	cm.CloseAll()
+	if !cm.Wait(ctx) {
+		log.Println("等待客户端断开超时")
+	}
+	if err := tenant.Save(*usageFile); err != nil {
+		log.Printf("保存租户用量失败: %v", err)
+	}
+
 	log.Println("服务器已关闭")
 }
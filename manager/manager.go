@@ -2,109 +2,331 @@ package manager
 
 import (
 	"context"
+	"io"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/FH-TianHe/BiliMux/metrics"
 )
 
 // 连接统计信息
 type ConnectionStats struct {
-	ActiveConnections int32 `json:"active_connections"`
-	TotalConnections  int32 `json:"total_connections"`
-	Errors            int32 `json:"errors"`
-	MessagesForwarded int32 `json:"messages_forwarded"`
+	ActiveConnections int64 `json:"active_connections"`
+	TotalConnections  int64 `json:"total_connections"`
+	Errors            int64 `json:"errors"`
+	MessagesForwarded int64 `json:"messages_forwarded"`
+	DroppedMessages   int64 `json:"dropped_messages"`
+	Rejected          int64 `json:"rejected"` // 被拒绝的客户端数，按原因分类见RejectedCounts
+	TranscodedFrames  int64 `json:"transcoded_frames"`
+	TranscodeTimeUs   int64 `json:"transcode_time_us"` // 转码累计耗时(微秒)
+	BytesOut          int64 `json:"bytes_out"`         // 发往客户端的消息字节数(压缩前)
+	WireBytesOut      int64 `json:"wire_bytes_out"`    // 实际写入网络的字节数(压缩后)
+}
+
+// 客户端连接信息
+type Client struct {
+	ID          uint64 // 登记时分配，用于管理接口
+	RemoteAddr  string
+	Identity    string // 认证身份名称
+	Tenant      string // 所属租户
+	RoomID      int
+	ConnectedAt time.Time
+	QueueLen    func() int // 发送队列当前长度
+
+	messages     int64
+	bytesOut     int64
+	wireBytesOut int64
+	dropped      int64
+	errors       int64
+	rate         metrics.Rate // 每秒发送的消息数
+}
+
+// 单个客户端的统计信息
+type ClientStats struct {
+	ID               uint64    `json:"id"`
+	RemoteAddr       string    `json:"remote_addr"`
+	Identity         string    `json:"identity,omitempty"`
+	Tenant           string    `json:"tenant,omitempty"`
+	RoomID           int       `json:"room_id"`
+	ConnectedAt      time.Time `json:"connected_at"`
+	ConnectedSeconds int64     `json:"connected_seconds"` // 已连接的时长
+	QueueLen         int       `json:"queue_len"`
+	Messages         int64     `json:"messages"`
+	MessagesPerSec   float64   `json:"messages_per_sec"` // 最近10秒的平均值
+	Dropped          int64     `json:"dropped"`
+	Errors           int64     `json:"errors"`
+	BytesOut         int64     `json:"bytes_out"`
+	WireBytesOut     int64     `json:"wire_bytes_out"`
+}
+
+func (c *Client) stats() ClientStats {
+	stats := ClientStats{
+		ID:               c.ID,
+		RemoteAddr:       c.RemoteAddr,
+		Identity:         c.Identity,
+		Tenant:           c.Tenant,
+		RoomID:           c.RoomID,
+		ConnectedAt:      c.ConnectedAt,
+		ConnectedSeconds: int64(time.Since(c.ConnectedAt).Seconds()),
+		Messages:         atomic.LoadInt64(&c.messages),
+		MessagesPerSec:   c.rate.PerSecond(),
+		Dropped:          atomic.LoadInt64(&c.dropped),
+		Errors:           atomic.LoadInt64(&c.errors),
+		BytesOut:         atomic.LoadInt64(&c.bytesOut),
+		WireBytesOut:     atomic.LoadInt64(&c.wireBytesOut),
+	}
+	if c.QueueLen != nil {
+		stats.QueueLen = c.QueueLen()
+	}
+	return stats
+}
+
+type connEntry struct {
+	cancel context.CancelFunc
+	client *Client
 }
 
 // 连接管理器
 type ConnectionManager struct {
 	mu         sync.RWMutex
-	conns      map[*websocket.Conn]context.CancelFunc
+	conns      map[io.Closer]connEntry
 	sem        chan struct{}
 	shutdown   context.Context
 	cancel     context.CancelFunc
 	stats      ConnectionStats
-	roomCache  sync.Map // 房间信息缓存
+	rejected   map[string]*int64 // 按原因统计的拒绝次数，创建后不再修改
+	nextID     uint64
 	danmuCache sync.Map // 弹幕信息缓存
 	buvidCache sync.Map // buvid缓存
 }
 
 func NewConnectionManager(maxConns int) *ConnectionManager {
 	ctx, cancel := context.WithCancel(context.Background())
+	rejected := make(map[string]*int64, len(rejectReasons))
+	for _, reason := range rejectReasons {
+		rejected[reason] = new(int64)
+	}
 	return &ConnectionManager{
-		conns:    make(map[*websocket.Conn]context.CancelFunc),
+		conns:    make(map[io.Closer]connEntry),
 		sem:      make(chan struct{}, maxConns),
 		shutdown: ctx,
 		cancel:   cancel,
+		rejected: rejected,
+	}
+}
+
+// 申请一个连接名额，成功后需调用Register登记连接或调用Release归还
+func (cm *ConnectionManager) TryAcquire() bool {
+	if cm.shutdown.Err() != nil {
+		return false
+	}
+	select {
+	case cm.sem <- struct{}{}:
+		return true
+	default:
+		return false
 	}
 }
 
-func (cm *ConnectionManager) Add(conn *websocket.Conn, cancel context.CancelFunc) bool {
+// 申请一个连接名额，没有空闲名额时等待直到ctx结束
+func (cm *ConnectionManager) Acquire(ctx context.Context) bool {
+	if cm.TryAcquire() {
+		return true
+	}
 	select {
 	case cm.sem <- struct{}{}:
-		cm.mu.Lock()
-		cm.conns[conn] = cancel
-		cm.mu.Unlock()
-		atomic.AddInt32(&cm.stats.ActiveConnections, 1)
-		atomic.AddInt32(&cm.stats.TotalConnections, 1)
 		return true
+	case <-ctx.Done():
+		return false
 	case <-cm.shutdown.Done():
 		return false
-	default:
+	}
+}
+
+// 归还未使用的连接名额
+func (cm *ConnectionManager) Release() {
+	<-cm.sem
+}
+
+// 登记已申请到名额的连接
+func (cm *ConnectionManager) Register(conn io.Closer, cancel context.CancelFunc, client *Client) {
+	if client != nil {
+		client.ID = atomic.AddUint64(&cm.nextID, 1)
+	}
+	cm.mu.Lock()
+	cm.conns[conn] = connEntry{cancel: cancel, client: client}
+	cm.mu.Unlock()
+	atomic.AddInt64(&cm.stats.ActiveConnections, 1)
+	atomic.AddInt64(&cm.stats.TotalConnections, 1)
+}
+
+// 申请名额并登记连接，没有空闲名额时返回false
+func (cm *ConnectionManager) Add(conn io.Closer, cancel context.CancelFunc, client *Client) bool {
+	if !cm.TryAcquire() {
 		return false
 	}
+	cm.Register(conn, cancel, client)
+	return true
 }
 
-func (cm *ConnectionManager) Remove(conn *websocket.Conn) {
+func (cm *ConnectionManager) Remove(conn io.Closer) {
 	cm.mu.Lock()
-	if cancel, ok := cm.conns[conn]; ok {
-		cancel()
+	if entry, ok := cm.conns[conn]; ok {
+		entry.cancel()
 		delete(cm.conns, conn)
 	}
 	cm.mu.Unlock()
 	<-cm.sem
-	atomic.AddInt32(&cm.stats.ActiveConnections, -1)
+	atomic.AddInt64(&cm.stats.ActiveConnections, -1)
+}
+
+// 断开指定ID的客户端，客户端不存在时返回false
+func (cm *ConnectionManager) Disconnect(id uint64) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	for conn, entry := range cm.conns {
+		if entry.client != nil && entry.client.ID == id {
+			entry.cancel()
+			conn.Close()
+			return true
+		}
+	}
+	return false
 }
 
 func (cm *ConnectionManager) CloseAll() {
 	cm.cancel()
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
-	for conn, cancel := range cm.conns {
-		cancel()
+	for conn, entry := range cm.conns {
+		entry.cancel()
 		conn.Close()
 	}
 }
 
+// 等待所有已登记的连接移除，ctx结束时返回false
+func (cm *ConnectionManager) Wait(ctx context.Context) bool {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&cm.stats.ActiveConnections) > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// 全局计数，只读取计数器，不遍历客户端
 func (cm *ConnectionManager) Stats() ConnectionStats {
 	return ConnectionStats{
-		ActiveConnections: atomic.LoadInt32(&cm.stats.ActiveConnections),
-		TotalConnections:  atomic.LoadInt32(&cm.stats.TotalConnections),
-		Errors:            atomic.LoadInt32(&cm.stats.Errors),
-		MessagesForwarded: atomic.LoadInt32(&cm.stats.MessagesForwarded),
+		ActiveConnections: atomic.LoadInt64(&cm.stats.ActiveConnections),
+		TotalConnections:  atomic.LoadInt64(&cm.stats.TotalConnections),
+		Errors:            atomic.LoadInt64(&cm.stats.Errors),
+		MessagesForwarded: atomic.LoadInt64(&cm.stats.MessagesForwarded),
+		DroppedMessages:   atomic.LoadInt64(&cm.stats.DroppedMessages),
+		Rejected:          atomic.LoadInt64(&cm.stats.Rejected),
+		TranscodedFrames:  atomic.LoadInt64(&cm.stats.TranscodedFrames),
+		TranscodeTimeUs:   atomic.LoadInt64(&cm.stats.TranscodeTimeUs),
+		BytesOut:          atomic.LoadInt64(&cm.stats.BytesOut),
+		WireBytesOut:      atomic.LoadInt64(&cm.stats.WireBytesOut),
 	}
 }
 
+// 所有已登记客户端的统计信息
+func (cm *ConnectionManager) ClientStats() []ClientStats {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	clients := []ClientStats{}
+	for _, entry := range cm.conns {
+		if entry.client != nil {
+			clients = append(clients, entry.client.stats())
+		}
+	}
+	return clients
+}
+
 func (cm *ConnectionManager) IncrementErrors() {
-	atomic.AddInt32(&cm.stats.Errors, 1)
+	atomic.AddInt64(&cm.stats.Errors, 1)
 }
 
-func (cm *ConnectionManager) IncrementMessages() {
-	atomic.AddInt32(&cm.stats.MessagesForwarded, 1)
+// 记录与某个客户端相关的错误
+func (cm *ConnectionManager) IncrementClientErrors(client *Client) {
+	cm.IncrementErrors()
+	if client != nil {
+		atomic.AddInt64(&client.errors, 1)
+	}
 }
 
-// 缓存管理方法
-func (cm *ConnectionManager) GetRoomCache(roomID int) (int, bool) {
-	if val, ok := cm.roomCache.Load(roomID); ok {
-		return val.(int), true
+// 记录发往客户端的一条消息
+func (cm *ConnectionManager) IncrementMessages(client *Client) {
+	atomic.AddInt64(&cm.stats.MessagesForwarded, 1)
+	if client != nil {
+		atomic.AddInt64(&client.messages, 1)
+		client.rate.Add(1)
 	}
-	return 0, false
 }
 
-func (cm *ConnectionManager) SetRoomCache(roomID, realRoomID int) {
-	cm.roomCache.Store(roomID, realRoomID)
+// 拒绝客户端的原因，认证和来源检查的拒绝由auth包统计
+const (
+	RejectLimit  = "limit"  // 达到最大连接数
+	RejectIP     = "ip"     // 超出单IP的连接数或频率限制
+	RejectRoom   = "room"   // 房间不允许订阅、不存在或无法访问B站
+	RejectTenant = "tenant" // 超出租户配额
+)
+
+var rejectReasons = []string{RejectLimit, RejectIP, RejectRoom, RejectTenant}
+
+// 记录被拒绝的客户端及原因
+func (cm *ConnectionManager) IncrementRejected(reason string) {
+	atomic.AddInt64(&cm.stats.Rejected, 1)
+	if n, ok := cm.rejected[reason]; ok {
+		atomic.AddInt64(n, 1)
+	}
+}
+
+// 按原因统计的被拒绝客户端数
+func (cm *ConnectionManager) RejectedCounts() map[string]int64 {
+	counts := make(map[string]int64, len(cm.rejected))
+	for reason, n := range cm.rejected {
+		counts[reason] = atomic.LoadInt64(n)
+	}
+	return counts
+}
+
+// 记录客户端发送队列溢出丢弃的消息
+func (cm *ConnectionManager) IncrementDropped(client *Client) {
+	atomic.AddInt64(&cm.stats.DroppedMessages, 1)
+	if client != nil {
+		atomic.AddInt64(&client.dropped, 1)
+	}
+}
+
+// 记录发往客户端的消息字节数(压缩前)
+func (cm *ConnectionManager) AddBytesOut(client *Client, n int) {
+	atomic.AddInt64(&cm.stats.BytesOut, int64(n))
+	if client != nil {
+		atomic.AddInt64(&client.bytesOut, int64(n))
+	}
+}
+
+// 记录实际写入网络的字节数(压缩后)
+func (cm *ConnectionManager) AddWireBytes(client *Client, n int) {
+	atomic.AddInt64(&cm.stats.WireBytesOut, int64(n))
+	if client != nil {
+		atomic.AddInt64(&client.wireBytesOut, int64(n))
+	}
+}
+
+// 记录一次转码耗时
+func (cm *ConnectionManager) AddTranscodeTime(d time.Duration) {
+	atomic.AddInt64(&cm.stats.TranscodedFrames, 1)
+	atomic.AddInt64(&cm.stats.TranscodeTimeUs, d.Microseconds())
 }
 
+// 缓存管理方法
 func (cm *ConnectionManager) GetDanmuCache(realRoomID int) (interface{}, bool) {
 	return cm.danmuCache.Load(realRoomID)
 }
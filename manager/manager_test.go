@@ -0,0 +1,35 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type closer struct{}
+
+func (closer) Close() error { return nil }
+
+func TestWait(t *testing.T) {
+	cm := NewConnectionManager(2)
+	conn := closer{}
+	if !cm.Add(conn, func() {}, &Client{}) {
+		t.Fatal("应能添加连接")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if cm.Wait(ctx) {
+		t.Fatal("还有连接时Wait应在超时后返回false")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cm.Remove(conn)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !cm.Wait(ctx) {
+		t.Error("连接移除后Wait应返回true")
+	}
+}
@@ -0,0 +1,67 @@
+package metrics
+
+// BiliMux自身的指标，抓取时才能计算的指标(连接数、房间等)由/metrics处理函数补充
+
+var (
+	messagesIn = NewCounter("bilimux_messages_in_total",
+		"从B站收到的业务消息数", "cmd")
+	messageBytesIn = NewCounter("bilimux_message_bytes_in_total",
+		"从B站收到的业务消息解压后的字节数", "cmd")
+	upstreamBytesIn = NewCounter("bilimux_upstream_bytes_in_total",
+		"从B站收到的数据帧字节数(压缩后)")
+	messagesOut = NewCounter("bilimux_messages_out_total",
+		"发送给客户端的消息数，每个客户端各计一次", "cmd")
+	messageBytesOut = NewCounter("bilimux_message_bytes_out_total",
+		"发送给客户端的消息原始内容字节数，不含编码和压缩", "cmd")
+
+	apiDuration = NewHistogram("bilimux_api_request_duration_seconds",
+		"调用B站接口的耗时", []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "api")
+	apiErrors = NewCounter("bilimux_api_errors_total",
+		"B站接口调用失败次数，code为B站返回的错误码、network或invalid", "api", "code")
+
+	reconnects = NewCounter("bilimux_upstream_reconnects_total",
+		"与B站服务器断开后的重连次数", "result")
+	loginEvents = NewCounter("bilimux_login_events_total",
+		"扫码登录事件", "event")
+)
+
+// 记录从B站收到的一条业务消息
+func MessageIn(cmd string, bytes int) {
+	messagesIn.Inc(cmd)
+	messageBytesIn.Add(float64(bytes), cmd)
+}
+
+// 记录从B站收到的一帧数据
+func FrameIn(bytes int) {
+	upstreamBytesIn.Add(float64(bytes))
+}
+
+// 记录发送给一个客户端的一条消息
+func MessageOut(cmd string, bytes int) {
+	messagesOut.Inc(cmd)
+	messageBytesOut.Add(float64(bytes), cmd)
+}
+
+// 记录一次B站接口调用的耗时
+func APICall(api string, seconds float64) {
+	apiDuration.Observe(seconds, api)
+}
+
+// 记录一次B站接口调用失败
+func APIError(api, code string) {
+	apiErrors.Inc(api, code)
+}
+
+// 记录一次重连，ok为是否成功
+func Reconnect(ok bool) {
+	if ok {
+		reconnects.Inc("success")
+	} else {
+		reconnects.Inc("failure")
+	}
+}
+
+// 记录扫码登录事件，如qrcode_issued、scanned、confirmed
+func LoginEvent(name string) {
+	loginEvents.Inc(name)
+}
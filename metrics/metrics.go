@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 按Prometheus文本格式输出的指标，不依赖client_golang
+
+// 一组同名指标，按标签值区分
+type family struct {
+	name   string
+	help   string
+	typ    string // counter、gauge或histogram
+	labels []string
+	bounds []float64 // 直方图各桶的上界，按升序排列
+
+	mu     sync.Mutex
+	series map[string]*series // 标签值拼接 -> 数据
+	index  sync.Map           // 与series相同，计数器不加锁查找
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	bits        uint64   // 计数器的值，按float64的位原子更新
+	buckets     []uint64 // 直方图各桶的计数，不含+Inf
+	count       uint64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*family
+)
+
+func newFamily(name, help, typ string, labels []string) *family {
+	f := &family{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+	registryMu.Lock()
+	registry = append(registry, f)
+	registryMu.Unlock()
+	return f
+}
+
+// 调用时需持有锁
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际为 %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// 取出标签值对应的数据，已存在时不加锁
+func (f *family) load(labelValues []string) *series {
+	key := strings.Join(labelValues, "\xff")
+	if s, ok := f.index.Load(key); ok {
+		return s.(*series)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.get(labelValues)
+	f.index.Store(key, s)
+	return s
+}
+
+// 只增不减的计数器，每个客户端发送消息时都会调用，不持有锁
+type Counter struct {
+	f *family
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{f: newFamily(name, help, "counter", labels)}
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	s := c.f.load(labelValues)
+	for {
+		old := atomic.LoadUint64(&s.bits)
+		if atomic.CompareAndSwapUint64(&s.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// 直方图，桶的上界按升序排列
+type Histogram struct {
+	f *family
+}
+
+func NewHistogram(name, help string, bounds []float64, labels ...string) *Histogram {
+	f := newFamily(name, help, "histogram", labels)
+	f.bounds = bounds
+	return &Histogram{f: f}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.f.bounds))
+	}
+	for i, bound := range h.f.bounds {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// 抓取时才计算的指标，如当前连接数
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// 输出指标的Writer，先输出已注册的指标，再由调用方补充抓取时计算的指标
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// 输出所有已注册的计数器和直方图
+func (w *Writer) WriteRegistered() {
+	registryMu.Lock()
+	families := append([]*family(nil), registry...)
+	registryMu.Unlock()
+
+	for _, f := range families {
+		w.writeFamily(f)
+	}
+}
+
+func (w *Writer) writeFamily(f *family) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.header(f.name, f.help, f.typ)
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != "histogram" {
+			w.sample(f.name, f.labels, s.labelValues, "", "", math.Float64frombits(atomic.LoadUint64(&s.bits)))
+			continue
+		}
+		for i, bound := range f.bounds {
+			w.sample(f.name+"_bucket", f.labels, s.labelValues, "le", formatValue(bound), float64(s.buckets[i]))
+		}
+		w.sample(f.name+"_bucket", f.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		w.sample(f.name+"_sum", f.labels, s.labelValues, "", "", s.value)
+		w.sample(f.name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// 输出一组抓取时计算的指标，typ为gauge或counter
+func (w *Writer) WriteSamples(name, help, typ string, samples []Sample) {
+	w.header(name, help, typ)
+	for _, s := range samples {
+		keys := make([]string, 0, len(s.Labels))
+		for k := range s.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]string, len(keys))
+		for i, k := range keys {
+			values[i] = s.Labels[k]
+		}
+		w.sample(name, keys, values, "", "", s.Value)
+	}
+}
+
+// 输出单个没有标签的指标
+func (w *Writer) WriteValue(name, help, typ string, value float64) {
+	w.WriteSamples(name, help, typ, []Sample{{Value: value}})
+}
+
+func (w *Writer) header(name, help, typ string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w.w, "# TYPE %s %s\n", name, typ)
+}
+
+func (w *Writer) sample(name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			fmt.Fprintf(w.w, "%s=\"%s\"", l, escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.w.WriteByte(',')
+			}
+			fmt.Fprintf(w.w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.w.WriteByte('}')
+	}
+	w.w.WriteByte(' ')
+	w.w.WriteString(formatValue(v))
+	w.w.WriteByte('\n')
+}
+
+// 将缓冲的内容写出
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
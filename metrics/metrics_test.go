@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 从注册表中移除测试创建的指标
+func unregister(f *family) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for i, r := range registry {
+		if r == f {
+			registry = append(registry[:i], registry[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestCounterConcurrent(t *testing.T) {
+	c := NewCounter("test_events_total", "测试", "cmd")
+	defer unregister(c.f)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := "DANMU_MSG"
+			if i%2 == 1 {
+				cmd = "SEND_GIFT"
+			}
+			for j := 0; j < 1000; j++ {
+				c.Inc(cmd)
+				c.Add(0.5, cmd)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.writeFamily(c.f)
+	w.Flush()
+
+	tests := []string{
+		"# TYPE test_events_total counter",
+		`test_events_total{cmd="DANMU_MSG"} 6000`,
+		`test_events_total{cmd="SEND_GIFT"} 6000`,
+	}
+	for _, want := range tests {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("输出中没有 %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestCounterLabelCount(t *testing.T) {
+	c := NewCounter("test_labels_total", "测试", "a", "b")
+	defer unregister(c.f)
+	defer func() {
+		if recover() == nil {
+			t.Error("标签值个数不符时应panic")
+		}
+	}()
+	c.Inc("only-one")
+}
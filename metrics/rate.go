@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// 计算速率的时间窗口(秒)
+const rateWindow = 10
+
+// 最近一段时间内每秒的平均数量，零值可直接使用
+type Rate struct {
+	mu      sync.Mutex
+	counts  [rateWindow]int64
+	seconds [rateWindow]int64 // 各计数所属的秒(Unix时间)
+}
+
+func (r *Rate) Add(n int64) {
+	now := time.Now().Unix()
+	i := now % rateWindow
+	r.mu.Lock()
+	if r.seconds[i] != now {
+		r.seconds[i] = now
+		r.counts[i] = 0
+	}
+	r.counts[i] += n
+	r.mu.Unlock()
+}
+
+// 最近rateWindow个完整秒的平均值，不含当前这一秒
+func (r *Rate) PerSecond() float64 {
+	now := time.Now().Unix()
+	var sum int64
+	r.mu.Lock()
+	for i, sec := range r.seconds {
+		if sec < now && now-sec <= rateWindow {
+			sum += r.counts[i]
+		}
+	}
+	r.mu.Unlock()
+	return float64(sum) / rateWindow
+}
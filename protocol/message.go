@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// 舰长等级，数值越小等级越高
+const (
+	GuardNone     = 0
+	GuardGovernor = 1 // 总督
+	GuardAdmiral  = 2 // 提督
+	GuardCaptain  = 3 // 舰长
+)
+
+// 解析后的业务消息(op=5)
+type Message struct {
+	Cmd        string          // 去掉协议后缀的命令名，如 DANMU_MSG
+	Raw        json.RawMessage // 原始JSON内容
+	Text       string          // 弹幕/醒目留言文本
+	UID        int64           // 发送者UID
+	Uname      string          // 发送者昵称
+	GiftValue  int64           // 价值，单位为金瓜子(1000 = 1元)
+	GuardLevel int             // 发送者舰长等级
+}
+
+// 解析业务消息并提取常用字段
+func ParseMessage(body []byte) (*Message, error) {
+	var base struct {
+		Cmd  string          `json:"cmd"`
+		Info json.RawMessage `json:"info"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &base); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		Cmd: base.Cmd,
+		Raw: json.RawMessage(body),
+	}
+	// 部分命令带有协议后缀，如 DANMU_MSG:4:0:2:2:2:0
+	if i := strings.IndexByte(msg.Cmd, ':'); i >= 0 {
+		msg.Cmd = msg.Cmd[:i]
+	}
+
+	switch msg.Cmd {
+	case "DANMU_MSG":
+		parseDanmuInfo(msg, base.Info)
+	case "SEND_GIFT":
+		var data struct {
+			UID        int64  `json:"uid"`
+			Uname      string `json:"uname"`
+			CoinType   string `json:"coin_type"`
+			TotalCoin  int64  `json:"total_coin"`
+			GuardLevel int    `json:"guard_level"`
+		}
+		if json.Unmarshal(base.Data, &data) == nil {
+			msg.UID, msg.Uname, msg.GuardLevel = data.UID, data.Uname, data.GuardLevel
+			if data.CoinType == "gold" {
+				msg.GiftValue = data.TotalCoin
+			}
+		}
+	case "SUPER_CHAT_MESSAGE":
+		var data struct {
+			UID      int64   `json:"uid"`
+			Message  string  `json:"message"`
+			Price    float64 `json:"price"`
+			UserInfo struct {
+				Uname      string `json:"uname"`
+				GuardLevel int    `json:"guard_level"`
+			} `json:"user_info"`
+		}
+		if json.Unmarshal(base.Data, &data) == nil {
+			msg.UID, msg.Uname, msg.Text = data.UID, data.UserInfo.Uname, data.Message
+			msg.GuardLevel = data.UserInfo.GuardLevel
+			msg.GiftValue = int64(data.Price * 1000)
+		}
+	case "GUARD_BUY":
+		var data struct {
+			UID        int64  `json:"uid"`
+			Username   string `json:"username"`
+			GuardLevel int    `json:"guard_level"`
+			Num        int64  `json:"num"`
+			Price      int64  `json:"price"`
+		}
+		if json.Unmarshal(base.Data, &data) == nil {
+			msg.UID, msg.Uname, msg.GuardLevel = data.UID, data.Username, data.GuardLevel
+			if data.Num <= 0 {
+				data.Num = 1
+			}
+			msg.GiftValue = data.Price * data.Num
+		}
+	case "INTERACT_WORD", "ENTRY_EFFECT", "LIKE_INFO_V3_CLICK":
+		var data struct {
+			UID        int64  `json:"uid"`
+			Uname      string `json:"uname"`
+			GuardLevel int    `json:"guard_level"`
+		}
+		if json.Unmarshal(base.Data, &data) == nil {
+			msg.UID, msg.Uname, msg.GuardLevel = data.UID, data.Uname, data.GuardLevel
+		}
+	}
+
+	return msg, nil
+}
+
+// 解析弹幕消息的info数组: info[1]为文本, info[2]为用户信息, info[7]为舰长等级
+func parseDanmuInfo(msg *Message, raw json.RawMessage) {
+	var info []json.RawMessage
+	if json.Unmarshal(raw, &info) != nil || len(info) < 3 {
+		return
+	}
+	json.Unmarshal(info[1], &msg.Text)
+
+	var user []json.RawMessage
+	if json.Unmarshal(info[2], &user) == nil && len(user) >= 2 {
+		json.Unmarshal(user[0], &msg.UID)
+		json.Unmarshal(user[1], &msg.Uname)
+	}
+
+	if len(info) > 7 {
+		json.Unmarshal(info[7], &msg.GuardLevel)
+	}
+}
+
+// 是否为礼物类消息
+func (m *Message) IsGift() bool {
+	switch m.Cmd {
+	case "SEND_GIFT", "SUPER_CHAT_MESSAGE", "GUARD_BUY":
+		return true
+	}
+	return false
+}
+
+// 是否携带文本内容
+func (m *Message) HasText() bool {
+	return m.Cmd == "DANMU_MSG" || m.Cmd == "SUPER_CHAT_MESSAGE"
+}
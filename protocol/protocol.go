@@ -9,7 +9,10 @@ import (
 	"io"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/gorilla/websocket"
+
+	"github.com/FH-TianHe/BiliMux/manager"
 )
 
 const (
@@ -32,6 +35,11 @@ type PacketHeader struct {
 	SequenceID   uint32
 }
 
+type Packet struct {
+	Header PacketHeader
+	Body   []byte
+}
+
 type AuthBody struct {
 	UID      int    `json:"uid"`
 	RoomID   int    `json:"roomid"`
@@ -44,22 +52,11 @@ type AuthBody struct {
 
 // 解析数据包
 func ParsePacket(data []byte) (header PacketHeader, body []byte, err error) {
-	if len(data) < HeaderLength {
-		return PacketHeader{}, nil, fmt.Errorf("数据包长度不足")
-	}
-
-	header.PacketLength = binary.BigEndian.Uint32(data[0:4])
-	header.HeaderLength = binary.BigEndian.Uint16(data[4:6])
-	header.Version = binary.BigEndian.Uint16(data[6:8])
-	header.Operation = binary.BigEndian.Uint32(data[8:12])
-	header.SequenceID = binary.BigEndian.Uint32(data[12:16])
-
-	if int(header.PacketLength) > len(data) {
-		return PacketHeader{}, nil, fmt.Errorf("数据包长度错误")
+	header, body, err = ParseHeader(data)
+	if err != nil {
+		return PacketHeader{}, nil, err
 	}
 
-	body = data[header.HeaderLength:header.PacketLength]
-
 	// 处理压缩数据
 	switch header.Version {
 	case VersionZlib:
@@ -74,12 +71,71 @@ func ParsePacket(data []byte) (header PacketHeader, body []byte, err error) {
 		}
 		body = decompressed
 	case VersionBrotli:
-		// TODO: 添加brotli解压支持
+		decompressed, err := io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+		if err != nil {
+			return PacketHeader{}, nil, err
+		}
+		body = decompressed
 	}
 
 	return header, body, nil
 }
 
+// 只解析包头，返回未解压的包体
+func ParseHeader(data []byte) (header PacketHeader, body []byte, err error) {
+	if len(data) < HeaderLength {
+		return PacketHeader{}, nil, fmt.Errorf("数据包长度不足")
+	}
+
+	header.PacketLength = binary.BigEndian.Uint32(data[0:4])
+	header.HeaderLength = binary.BigEndian.Uint16(data[4:6])
+	header.Version = binary.BigEndian.Uint16(data[6:8])
+	header.Operation = binary.BigEndian.Uint32(data[8:12])
+	header.SequenceID = binary.BigEndian.Uint32(data[12:16])
+
+	if int(header.PacketLength) > len(data) || header.HeaderLength < HeaderLength || header.PacketLength < uint32(header.HeaderLength) {
+		return PacketHeader{}, nil, fmt.Errorf("数据包长度错误")
+	}
+
+	return header, data[header.HeaderLength:header.PacketLength], nil
+}
+
+// 封装数据包
+func EncodePacket(operation uint32, version uint16, body []byte) []byte {
+	packet := make([]byte, HeaderLength+len(body))
+	binary.BigEndian.PutUint32(packet[0:4], uint32(len(packet)))
+	binary.BigEndian.PutUint16(packet[4:6], HeaderLength)
+	binary.BigEndian.PutUint16(packet[6:8], version)
+	binary.BigEndian.PutUint32(packet[8:12], operation)
+	binary.BigEndian.PutUint32(packet[12:16], 1)
+	copy(packet[HeaderLength:], body)
+	return packet
+}
+
+// 拆分一帧中的全部数据包，压缩包会被解压并展开为其中的子包
+func SplitPackets(data []byte) ([]Packet, error) {
+	var packets []Packet
+	for len(data) > 0 {
+		header, body, err := ParsePacket(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Operation == OpMessage && isCompressed(header.Version) {
+			inner, err := SplitPackets(body)
+			if err != nil {
+				return nil, err
+			}
+			packets = append(packets, inner...)
+		} else {
+			packets = append(packets, Packet{Header: header, Body: body})
+		}
+
+		data = data[header.PacketLength:]
+	}
+	return packets, nil
+}
+
 // 创建认证包
 func CreateAuthPacket(roomID int, token, buvid3 string) ([]byte, error) {
 	authBody := AuthBody{
@@ -97,43 +153,12 @@ func CreateAuthPacket(roomID int, token, buvid3 string) ([]byte, error) {
 		return nil, err
 	}
 
-	header := PacketHeader{
-		PacketLength: uint32(HeaderLength + len(body)),
-		HeaderLength: HeaderLength,
-		Version:      1,
-		Operation:    OpAuth,
-		SequenceID:   1,
-	}
-
-	packet := make([]byte, header.PacketLength)
-	binary.BigEndian.PutUint32(packet[0:4], header.PacketLength)
-	binary.BigEndian.PutUint16(packet[4:6], header.HeaderLength)
-	binary.BigEndian.PutUint16(packet[6:8], header.Version)
-	binary.BigEndian.PutUint32(packet[8:12], header.Operation)
-	binary.BigEndian.PutUint32(packet[12:16], header.SequenceID)
-	copy(packet[16:], body)
-
-	return packet, nil
+	return EncodePacket(OpAuth, 1, body), nil
 }
 
 // 创建心跳包
 func CreateHeartbeatPacket() []byte {
-	header := PacketHeader{
-		PacketLength: HeaderLength,
-		HeaderLength: HeaderLength,
-		Version:      1,
-		Operation:    OpHeartbeat,
-		SequenceID:   1,
-	}
-
-	packet := make([]byte, header.PacketLength)
-	binary.BigEndian.PutUint32(packet[0:4], header.PacketLength)
-	binary.BigEndian.PutUint16(packet[4:6], header.HeaderLength)
-	binary.BigEndian.PutUint16(packet[6:8], header.Version)
-	binary.BigEndian.PutUint32(packet[8:12], header.Operation)
-	binary.BigEndian.PutUint32(packet[12:16], header.SequenceID)
-
-	return packet
+	return EncodePacket(OpHeartbeat, 1, nil)
 }
 
 // 处理心跳
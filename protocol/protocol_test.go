@@ -0,0 +1,98 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParsePacket(t *testing.T) {
+	valid := EncodePacket(OpMessage, VersionPlain, []byte(`{"cmd":"DANMU_MSG"}`))
+	withHeader := func(packetLen uint32, headerLen uint16) []byte {
+		data := append([]byte(nil), valid...)
+		binary.BigEndian.PutUint32(data[0:4], packetLen)
+		binary.BigEndian.PutUint16(data[4:6], headerLen)
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantBody string
+		wantErr  bool
+	}{
+		{"正常", valid, `{"cmd":"DANMU_MSG"}`, false},
+		{"帧中还有其他数据包", append(append([]byte(nil), valid...), valid...), `{"cmd":"DANMU_MSG"}`, false},
+		{"空包体", EncodePacket(OpHeartbeat, VersionPlain, nil), "", false},
+		{"不足包头长度", valid[:HeaderLength-1], "", true},
+		{"包长度超出数据", withHeader(uint32(len(valid)+1), HeaderLength), "", true},
+		{"包头长度过小", withHeader(uint32(len(valid)), HeaderLength-1), "", true},
+		{"包长度小于包头长度", withHeader(HeaderLength-1, HeaderLength), "", true},
+		{"无效的zlib数据", EncodePacket(OpMessage, VersionZlib, []byte("not zlib")), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, body, err := ParsePacket(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if header.HeaderLength != HeaderLength {
+				t.Errorf("HeaderLength = %d", header.HeaderLength)
+			}
+		})
+	}
+}
+
+func TestSplitPackets(t *testing.T) {
+	a := EncodePacket(OpMessage, VersionPlain, []byte(`{"cmd":"A"}`))
+	b := EncodePacket(OpMessage, VersionPlain, []byte(`{"cmd":"B"}`))
+	heartbeat := EncodePacket(OpHeartbeatReply, 1, []byte{0, 0, 0, 1})
+	zlibbed, err := CompressPackets(append(append([]byte(nil), a...), b...), VersionZlib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brotlied, err := CompressPackets(append(append([]byte(nil), b...), a...), VersionBrotli)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr bool
+	}{
+		{"单个数据包", a, []string{`{"cmd":"A"}`}, false},
+		{"多个数据包", append(append([]byte(nil), a...), heartbeat...), []string{`{"cmd":"A"}`, "\x00\x00\x00\x01"}, false},
+		{"zlib压缩包展开", zlibbed, []string{`{"cmd":"A"}`, `{"cmd":"B"}`}, false},
+		{"brotli压缩包展开", brotlied, []string{`{"cmd":"B"}`, `{"cmd":"A"}`}, false},
+		{"压缩包与普通包混合", append(append([]byte(nil), heartbeat...), zlibbed...), []string{"\x00\x00\x00\x01", `{"cmd":"A"}`, `{"cmd":"B"}`}, false},
+		{"末尾数据不完整", append(append([]byte(nil), a...), b[:10]...), nil, true},
+		{"空帧", nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets, err := SplitPackets(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(packets) != len(tt.want) {
+				t.Fatalf("拆出 %d 个数据包，want %d", len(packets), len(tt.want))
+			}
+			for i, p := range packets {
+				if !bytes.Equal(p.Body, []byte(tt.want[i])) {
+					t.Errorf("数据包 %d = %q, want %q", i, p.Body, tt.want[i])
+				}
+				if isCompressed(p.Header.Version) {
+					t.Errorf("数据包 %d 未展开", i)
+				}
+			}
+		})
+	}
+}
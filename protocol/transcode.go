@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/zlib"
+
+	"github.com/andybalholm/brotli"
+)
+
+// 将客户端认证包中的protover转换为数据包版本，0和1都表示不压缩
+func NormalizeVersion(protover int) uint16 {
+	switch protover {
+	case VersionZlib, VersionBrotli:
+		return uint16(protover)
+	}
+	return VersionPlain
+}
+
+// 将若干未压缩的消息包按指定版本压缩为一个数据包
+func CompressPackets(packets []byte, version uint16) ([]byte, error) {
+	if len(packets) == 0 || !isCompressed(version) {
+		return packets, nil
+	}
+
+	var buf bytes.Buffer
+	switch version {
+	case VersionZlib:
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(packets); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case VersionBrotli:
+		w := brotli.NewWriterLevel(&buf, brotli.DefaultCompression)
+		if _, err := w.Write(packets); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return EncodePacket(OpMessage, version, buf.Bytes()), nil
+}
+
+func isCompressed(version uint16) bool {
+	return version == VersionZlib || version == VersionBrotli
+}
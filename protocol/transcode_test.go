@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct {
+		protover int
+		want     uint16
+	}{
+		{-1, VersionPlain},
+		{0, VersionPlain},
+		{1, VersionPlain},
+		{2, VersionZlib},
+		{3, VersionBrotli},
+		{4, VersionPlain},
+	}
+	for _, tt := range tests {
+		if got := NormalizeVersion(tt.protover); got != tt.want {
+			t.Errorf("NormalizeVersion(%d) = %d, want %d", tt.protover, got, tt.want)
+		}
+	}
+}
+
+func TestCompressPackets(t *testing.T) {
+	packets := append(
+		EncodePacket(OpMessage, VersionPlain, []byte(`{"cmd":"DANMU_MSG","info":[]}`)),
+		EncodePacket(OpMessage, VersionPlain, []byte(`{"cmd":"SEND_GIFT","data":{}}`))...,
+	)
+	tests := []struct {
+		name    string
+		version uint16
+	}{
+		{"不压缩", VersionPlain},
+		{"zlib", VersionZlib},
+		{"brotli", VersionBrotli},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := CompressPackets(packets, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.version == VersionPlain {
+				if !bytes.Equal(data, packets) {
+					t.Error("不压缩时应原样返回")
+				}
+				return
+			}
+
+			header, body, err := ParsePacket(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Version != tt.version || header.Operation != OpMessage {
+				t.Errorf("包头 version=%d op=%d", header.Version, header.Operation)
+			}
+			if int(header.PacketLength) != len(data) {
+				t.Errorf("PacketLength = %d, want %d", header.PacketLength, len(data))
+			}
+			if !bytes.Equal(body, packets) {
+				t.Error("解压后与原数据包不一致")
+			}
+		})
+	}
+
+	if data, err := CompressPackets(nil, VersionZlib); err != nil || len(data) != 0 {
+		t.Errorf("空数据 = %v, %v", data, err)
+	}
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/FH-TianHe/BiliMux/auth"
+)
+
+// 从请求元数据中取出凭证并校验，支持authorization: Bearer和x-api-key
+func authenticate(ctx context.Context) (context.Context, error) {
+	var credential string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 && strings.HasPrefix(v[0], "Bearer ") {
+			credential = strings.TrimSpace(strings.TrimPrefix(v[0], "Bearer "))
+		} else if v := md.Get("x-api-key"); len(v) > 0 {
+			credential = v[0]
+		}
+	}
+
+	id, err := auth.Check(credential)
+	if err != nil {
+		log.Printf("gRPC认证失败: %s: %v", peerAddr(ctx), err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return auth.WithIdentity(ctx, id), nil
+}
+
+func unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// 携带认证身份的流
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,387 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/FH-TianHe/BiliMux/auth"
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/filter"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/limit"
+	"github.com/FH-TianHe/BiliMux/manager"
+	"github.com/FH-TianHe/BiliMux/metrics"
+	"github.com/FH-TianHe/BiliMux/tenant"
+)
+
+// 每个订阅缓存的事件批数，写不过来时丢弃最新的事件并在之后发送断档标记
+const subscriberBuffer = 256
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative bilimux.proto
+
+// gRPC服务，与HTTP服务共享连接管理器和房间
+type service struct {
+	UnimplementedBiliMuxServer
+	cm    *manager.ConnectionManager
+	rooms *hub.Hub
+}
+
+// 创建gRPC服务器
+func NewServer(cm *manager.ConnectionManager, rooms *hub.Hub) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryAuth),
+		grpc.StreamInterceptor(streamAuth),
+	)
+	RegisterBiliMuxServer(server, &service{cm: cm, rooms: rooms})
+	return server
+}
+
+func (s *service) GetRoom(ctx context.Context, req *GetRoomRequest) (*RoomInfo, error) {
+	if req.RoomId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "无效的房间ID")
+	}
+	// 与Subscribe一样先检查禁止和允许列表，不能订阅的房间不返回信息也不请求B站
+	realRoomID, err := s.rooms.Check(int(req.RoomId))
+	if err != nil {
+		return nil, joinStatus(err)
+	}
+
+	info := &RoomInfo{RoomId: req.RoomId, RealRoomId: int64(realRoomID)}
+	if room, ok := s.rooms.Lookup(realRoomID); ok {
+		ri := room.Info()
+		info.Connected = ri.Connected
+		info.Host = ri.Host
+		info.Subscribers = int32(ri.Subscribers)
+		info.Seq = ri.Seq
+		info.Popularity = ri.Popularity
+	}
+	return info, nil
+}
+
+func (s *service) GetStats(ctx context.Context, req *GetStatsRequest) (*Stats, error) {
+	if !auth.Authorize(auth.FromContext(ctx), auth.RoleViewer, "GetStats", peerAddr(ctx)) {
+		return nil, status.Error(codes.PermissionDenied, "权限不足")
+	}
+	stats := s.cm.Stats()
+	return &Stats{
+		ActiveConnections: stats.ActiveConnections,
+		TotalConnections:  stats.TotalConnections,
+		Errors:            stats.Errors,
+		MessagesForwarded: stats.MessagesForwarded,
+		DroppedMessages:   stats.DroppedMessages,
+		BytesOut:          stats.BytesOut,
+		WireBytesOut:      stats.WireBytesOut,
+		Rooms:             int32(len(s.rooms.Rooms())),
+	}, nil
+}
+
+func (s *service) Subscribe(req *SubscribeRequest, stream grpc.ServerStreamingServer[Event]) error {
+	if len(req.RoomIds) == 0 {
+		return status.Error(codes.InvalidArgument, "缺少room_ids")
+	}
+	f, err := compileFilter(req.Filter)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	ip := peerIP(ctx)
+	if err := limit.Open(ip); err != nil {
+		s.cm.IncrementRejected(manager.RejectIP)
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer limit.Close(ip)
+
+	// 检查租户配额
+	id := auth.FromContext(ctx)
+	account := tenant.Get(id.Tenant)
+	if err := account.Open(); err != nil {
+		s.cm.IncrementRejected(manager.RejectTenant)
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer account.Close()
+
+	client := &manager.Client{
+		RemoteAddr:  peerAddr(ctx),
+		Identity:    id.Name,
+		Tenant:      id.Tenant,
+		RoomID:      int(req.RoomIds[0]),
+		ConnectedAt: time.Now(),
+	}
+	sub := &subscriber{
+		cm:      s.cm,
+		client:  client,
+		filter:  f,
+		ch:      make(chan []*event.Event, subscriberBuffer),
+		cancel:  cancel,
+		account: account,
+	}
+	client.QueueLen = func() int { return len(sub.ch) }
+
+	// 添加到连接管理器
+	if !s.cm.Add(sub, cancel, client) {
+		s.cm.IncrementRejected(manager.RejectLimit)
+		return status.Error(codes.ResourceExhausted, "达到最大连接数限制")
+	}
+	defer s.cm.Remove(sub)
+
+	for _, roomID := range req.RoomIds {
+		realRoomID, err := s.rooms.Check(int(roomID))
+		if err != nil {
+			s.cm.IncrementRejected(manager.RejectRoom)
+			return joinStatus(err)
+		}
+		if err := account.JoinRoom(realRoomID); err != nil {
+			s.cm.IncrementRejected(manager.RejectTenant)
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		defer account.LeaveRoom(realRoomID)
+
+		room, err := s.rooms.Join(int(roomID), sub, hub.JoinOptions{Since: -1, Backfill: req.Backfill})
+		if err != nil {
+			log.Printf("加入房间 %d 失败: %v", roomID, err)
+			s.cm.IncrementClientErrors(client)
+			return joinStatus(err)
+		}
+		defer s.rooms.Leave(room, sub)
+	}
+
+	log.Printf("已建立gRPC订阅: %s (%s) <-> 房间 %v", client.RemoteAddr, client.Identity, req.RoomIds)
+	defer log.Printf("gRPC订阅关闭: %s", client.RemoteAddr)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := stream.Context().Err(); err != nil {
+				return err
+			}
+			if err := sub.kickErr(); err != nil {
+				return joinStatus(err)
+			}
+			return status.Error(codes.Unavailable, "连接已被服务端关闭")
+		case events := <-sub.ch:
+			for _, ev := range events {
+				msg, err := toEvent(ev)
+				if err != nil {
+					log.Printf("编码事件失败: %v", err)
+					s.cm.IncrementClientErrors(client)
+					continue
+				}
+				if !account.Spend(1) {
+					return status.Error(codes.ResourceExhausted, "本月的消息额度已用完")
+				}
+				if err := stream.Send(msg); err != nil {
+					account.Refund(1)
+					return err
+				}
+				s.cm.IncrementMessages(client)
+				metrics.MessageOut(ev.Cmd, ev.RawSize())
+				s.cm.AddBytesOut(client, len(msg.Data))
+				account.AddBytes(len(msg.Data))
+			}
+		}
+	}
+}
+
+// gRPC订阅者，在房间的goroutine中接收事件并放入缓冲
+type subscriber struct {
+	cm      *manager.ConnectionManager
+	client  *manager.Client
+	filter  *filter.Filter
+	ch      chan []*event.Event
+	cancel  context.CancelFunc
+	account *tenant.Account
+
+	mu     sync.Mutex
+	kicked error        // 被服务端断开的原因，如房间被关闭
+	gaps   map[int]*gap // 缓冲已满时各房间丢弃的事件，下次放入缓冲时先发送断档标记
+}
+
+// 一个房间中因缓冲已满而丢弃的事件
+type gap struct {
+	from, to uint64 // 丢弃的序号范围，历史弹幕没有序号
+	dropped  int
+}
+
+// 在房间的goroutine中调用，多个房间可能同时调用。
+// 缓冲已满时丢弃事件，之后与WebSocket客户端一样先收到BILIMUX_GAP断档标记。
+// 消息数和租户额度在事件实际发送后才计算。
+func (s *subscriber) Deliver(events []*event.Event) {
+	kept := make([]*event.Event, 0, len(events))
+	for _, ev := range events {
+		if msg := ev.Message(); msg != nil && s.filter != nil && !s.filter.Match(msg) {
+			continue
+		}
+		kept = append(kept, ev)
+	}
+	if len(kept) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := kept
+	if len(s.gaps) > 0 {
+		batch = append(s.gapNotices(), kept...)
+	}
+	select {
+	case s.ch <- batch:
+		s.gaps = nil
+	default:
+		for _, ev := range kept {
+			s.cm.IncrementDropped(s.client)
+			s.addGap(ev)
+		}
+	}
+}
+
+// 调用时需持有锁
+func (s *subscriber) addGap(ev *event.Event) {
+	if s.gaps == nil {
+		s.gaps = make(map[int]*gap)
+	}
+	g := s.gaps[ev.RoomID]
+	if g == nil {
+		g = &gap{}
+		s.gaps[ev.RoomID] = g
+	}
+	g.dropped++
+	if ev.Seq == 0 {
+		return
+	}
+	if g.from == 0 || ev.Seq < g.from {
+		g.from = ev.Seq
+	}
+	if ev.Seq > g.to {
+		g.to = ev.Seq
+	}
+}
+
+// 调用时需持有锁
+func (s *subscriber) gapNotices() []*event.Event {
+	roomIDs := make([]int, 0, len(s.gaps))
+	for id := range s.gaps {
+		roomIDs = append(roomIDs, id)
+	}
+	sort.Ints(roomIDs)
+
+	notices := make([]*event.Event, 0, len(roomIDs))
+	for _, id := range roomIDs {
+		g := s.gaps[id]
+		data := map[string]interface{}{"dropped": g.dropped}
+		if g.from != 0 {
+			data["from"], data["to"] = g.from, g.to
+		}
+		notices = append(notices, event.Notice(id, hub.GapCmd, data))
+	}
+	return notices
+}
+
+// 房间被关闭时由房间调用，结束订阅
+func (s *subscriber) Kick(err error) {
+	s.mu.Lock()
+	s.kicked = err
+	s.mu.Unlock()
+	s.cancel()
+}
+
+func (s *subscriber) kickErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kicked
+}
+
+// 连接管理器关闭所有连接时结束订阅
+func (s *subscriber) Close() error {
+	s.cancel()
+	return nil
+}
+
+// 将请求中的过滤规则转换为与WebSocket接口相同的规则，没有条件时返回nil
+func compileFilter(f *Filter) (*filter.Filter, error) {
+	if f == nil {
+		return nil, nil
+	}
+	out := &filter.Filter{
+		Cmds:          f.Cmds,
+		ExcludeCmds:   f.ExcludeCmds,
+		Keywords:      f.Keywords,
+		Regex:         f.Regex,
+		UIDs:          f.Uids,
+		ExcludeUIDs:   f.ExcludeUids,
+		MinGiftValue:  f.MinGiftValue,
+		MinGuardLevel: int(f.MinGuardLevel),
+	}
+	if err := out.Compile(); err != nil {
+		return nil, err
+	}
+	if out.Empty() {
+		return nil, nil
+	}
+	return out, nil
+}
+
+func toEvent(ev *event.Event) (*Event, error) {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		Seq:        ev.Seq,
+		Cmd:        ev.Cmd,
+		RoomId:     int64(ev.RoomID),
+		Ts:         ev.Time,
+		Uid:        ev.UID,
+		Uname:      ev.Uname,
+		Text:       ev.Text,
+		GiftValue:  ev.GiftValue,
+		GuardLevel: int32(ev.GuardLevel),
+		Backfill:   ev.Backfill,
+		Data:       data,
+	}, nil
+}
+
+// 将加入房间的错误转换为gRPC状态，消息中保留错误码
+func joinStatus(err error) error {
+	je, ok := err.(*hub.Error)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code := codes.Unavailable
+	switch je.Code {
+	case hub.CodeRoomDenied:
+		code = codes.PermissionDenied
+	case hub.CodeRoomNotFound:
+		code = codes.NotFound
+	case hub.CodeRoomFull:
+		code = codes.ResourceExhausted
+	case hub.CodeRoomClosed:
+		code = codes.Aborted
+	}
+	return status.Error(code, je.Error())
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+func peerIP(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return limit.AddrIP(p.Addr)
+	}
+	return "unknown"
+}
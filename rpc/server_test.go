@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/FH-TianHe/BiliMux/config"
+	"github.com/FH-TianHe/BiliMux/event"
+	"github.com/FH-TianHe/BiliMux/hub"
+	"github.com/FH-TianHe/BiliMux/manager"
+)
+
+func TestSubscriberGap(t *testing.T) {
+	sub := &subscriber{
+		cm:     manager.NewConnectionManager(1),
+		client: &manager.Client{},
+		ch:     make(chan []*event.Event, 1),
+		cancel: func() {},
+	}
+	ev := func(roomID int, seq uint64) *event.Event {
+		return &event.Event{Cmd: "DANMU_MSG", RoomID: roomID, Seq: seq}
+	}
+
+	sub.Deliver([]*event.Event{ev(1, 1)})
+	// 缓冲已满，以下事件被丢弃
+	sub.Deliver([]*event.Event{ev(1, 2), ev(1, 3)})
+	sub.Deliver([]*event.Event{ev(2, 7)})
+	sub.Deliver([]*event.Event{{Cmd: "DANMU_MSG", RoomID: 2, Backfill: true}})
+
+	if got := <-sub.ch; len(got) != 1 || got[0].Seq != 1 {
+		t.Fatalf("第一批 = %v", got)
+	}
+	sub.Deliver([]*event.Event{ev(1, 4)})
+	got := <-sub.ch
+
+	tests := []struct {
+		roomID int
+		data   map[string]interface{}
+	}{
+		{1, map[string]interface{}{"dropped": 2, "from": uint64(2), "to": uint64(3)}},
+		{2, map[string]interface{}{"dropped": 2, "from": uint64(7), "to": uint64(7)}},
+	}
+	if len(got) != len(tests)+1 {
+		t.Fatalf("第二批有 %d 个事件，want %d", len(got), len(tests)+1)
+	}
+	for i, tt := range tests {
+		if got[i].Cmd != hub.GapCmd || got[i].RoomID != tt.roomID {
+			t.Errorf("事件 %d = %s 房间 %d，want %s 房间 %d", i, got[i].Cmd, got[i].RoomID, hub.GapCmd, tt.roomID)
+		}
+		if !reflect.DeepEqual(got[i].Data, tt.data) {
+			t.Errorf("事件 %d 的内容 = %v, want %v", i, got[i].Data, tt.data)
+		}
+	}
+	if last := got[len(got)-1]; last.Seq != 4 {
+		t.Errorf("最后的事件序号 = %d, want 4", last.Seq)
+	}
+
+	// 断档标记只发送一次
+	sub.Deliver([]*event.Event{ev(1, 5)})
+	if got := <-sub.ch; len(got) != 1 || got[0].Seq != 5 {
+		t.Errorf("第三批 = %v", got)
+	}
+}
+
+func TestGetRoomDenied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"allowed_rooms":[],"denied_rooms":[5440]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ioutil.WriteFile(path, []byte(`{"allowed_rooms":[],"denied_rooms":[]}`), 0644)
+		config.LoadConfig(path)
+	})
+
+	cm := manager.NewConnectionManager(1)
+	s := &service{cm: cm, rooms: hub.New(cm, hub.Options{})}
+	_, err := s.GetRoom(context.Background(), &GetRoomRequest{RoomId: 5440})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("err = %v, want PermissionDenied", err)
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      *Filter
+		wantNil bool
+		wantErr bool
+	}{
+		{"没有过滤规则", nil, true, false},
+		{"空规则", &Filter{}, true, false},
+		{"有条件", &Filter{Cmds: []string{"DANMU_MSG"}, Uids: []int64{-1, 42}, MinGuardLevel: 3}, false, false},
+		{"无效的正则", &Filter{Regex: "("}, false, true},
+		{"舰长等级超出范围", &Filter{MinGuardLevel: 4}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileFilter(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("got %+v, wantNil %v", got, tt.wantNil)
+			}
+			if got != nil && (!reflect.DeepEqual(got.Cmds, tt.in.Cmds) || !reflect.DeepEqual(got.UIDs, tt.in.Uids) || got.MinGuardLevel != int(tt.in.MinGuardLevel)) {
+				t.Errorf("got %+v, want %+v", got, tt.in)
+			}
+		})
+	}
+}
+
+func TestToEvent(t *testing.T) {
+	ev := &event.Event{
+		Seq: 7, Cmd: "SEND_GIFT", RoomID: 5440, Time: 1700000000123, UID: -1, Uname: "用户",
+		GiftValue: 1000, GuardLevel: 3, Backfill: true, Data: map[string]int{"num": 1},
+	}
+	got, err := toEvent(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Event{
+		Seq: 7, Cmd: "SEND_GIFT", RoomId: 5440, Ts: 1700000000123, Uid: -1, Uname: "用户",
+		GiftValue: 1000, GuardLevel: 3, Backfill: true, Data: []byte(`{"num":1}`),
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// 经过protobuf编解码后保持不变
+	b, err := proto.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Event{}
+	if err := proto.Unmarshal(b, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(decoded, want) {
+		t.Errorf("decoded %v, want %v", decoded, want)
+	}
+}
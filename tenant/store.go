@@ -0,0 +1,83 @@
+package tenant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 从文件加载用量，文件不存在时从零开始
+func Load(filePath string) error {
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved map[string]map[string]*Usage // 租户 -> 月份 -> 用量
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	for name, usage := range saved {
+		a := getLocked(name)
+		a.mu.Lock()
+		for m, u := range usage {
+			a.usage[m] = u
+		}
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// 将用量写入文件，先写临时文件再重命名，避免写到一半时损坏
+func Save(filePath string) error {
+	accountsMu.Lock()
+	saved := make(map[string]map[string]*Usage, len(accounts))
+	for name, a := range accounts {
+		a.mu.Lock()
+		usage := make(map[string]*Usage, len(a.usage))
+		for m, u := range a.usage {
+			copied := *u
+			usage[m] = &copied
+		}
+		a.mu.Unlock()
+		saved[name] = usage
+	}
+	accountsMu.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	tmp := filePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
+
+// 定期保存用量，退出前还需调用Save保存最后的用量。
+// interval不大于0时不定期保存，只在退出时保存。
+func Persist(filePath string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := Save(filePath); err != nil {
+			log.Printf("保存租户用量失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package tenant
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/config"
+)
+
+// 超出租户配额时的错误码，与房间错误码一致为4000加上HTTP状态码
+const CodeQuotaExceeded = 4429
+
+// 超出租户配额
+type QuotaError struct {
+	Message string
+}
+
+func (e *QuotaError) Error() string {
+	return e.Message
+}
+
+// 某个月的用量
+type Usage struct {
+	Messages    int64 `json:"messages"`    // 转发的消息数
+	BytesOut    int64 `json:"bytes_out"`   // 发送的字节数
+	Connections int64 `json:"connections"` // 新建的连接数
+	Rejected    int64 `json:"rejected"`    // 因配额被拒绝的连接数
+}
+
+// 租户的运行状态和用量，nil表示不属于任何租户，所有方法都不做限制
+type Account struct {
+	Name string
+
+	mu    sync.Mutex
+	conns int
+	rooms map[int]int       // 真实房间ID -> 订阅数
+	usage map[string]*Usage // 月份(2006-01) -> 用量
+}
+
+var (
+	accountsMu sync.Mutex
+	accounts   = make(map[string]*Account)
+)
+
+// 租户的账户，name为空时返回nil
+func Get(name string) *Account {
+	if name == "" {
+		return nil
+	}
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	return getLocked(name)
+}
+
+func getLocked(name string) *Account {
+	a, ok := accounts[name]
+	if !ok {
+		a = &Account{Name: name, rooms: make(map[int]int), usage: make(map[string]*Usage)}
+		accounts[name] = a
+	}
+	return a
+}
+
+// 当前时间，测试中替换以模拟跨月
+var now = time.Now
+
+// 当前月份
+func month() string {
+	return now().Format("2006-01")
+}
+
+// 配置文件中的配额，租户被删除后返回nil
+func (a *Account) limits() *config.Tenant {
+	for _, t := range config.GetConfig().Tenants {
+		if t.Name == a.Name {
+			return &t
+		}
+	}
+	return nil
+}
+
+// 调用时需持有锁
+func (a *Account) current() *Usage {
+	m := month()
+	u, ok := a.usage[m]
+	if !ok {
+		u = &Usage{}
+		a.usage[m] = u
+	}
+	return u
+}
+
+// 为新连接占用名额，超出并发连接数或本月消息额度已用完时返回错误。成功后需调用Close
+func (a *Account) Open() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u := a.current()
+	lim := a.limits()
+	if lim == nil {
+		u.Rejected++
+		return &QuotaError{Message: fmt.Sprintf("租户 %s 不存在", a.Name)}
+	}
+	if lim.MaxConns > 0 && a.conns >= lim.MaxConns {
+		u.Rejected++
+		return &QuotaError{Message: fmt.Sprintf("租户 %s 的连接数已达上限", a.Name)}
+	}
+	if lim.MessageBudget > 0 && u.Messages >= lim.MessageBudget {
+		u.Rejected++
+		return &QuotaError{Message: fmt.Sprintf("租户 %s 本月的消息额度已用完", a.Name)}
+	}
+	a.conns++
+	u.Connections++
+	return nil
+}
+
+func (a *Account) Close() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.conns--
+}
+
+// 订阅房间，超出同时订阅的房间数时返回错误。成功后需调用LeaveRoom
+func (a *Account) JoinRoom(realRoomID int) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.rooms[realRoomID]; !ok {
+		if lim := a.limits(); lim != nil && lim.MaxRooms > 0 && len(a.rooms) >= lim.MaxRooms {
+			a.current().Rejected++
+			return &QuotaError{Message: fmt.Sprintf("租户 %s 订阅的房间数已达上限", a.Name)}
+		}
+	}
+	a.rooms[realRoomID]++
+	return nil
+}
+
+func (a *Account) LeaveRoom(realRoomID int) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rooms[realRoomID]--; a.rooms[realRoomID] <= 0 {
+		delete(a.rooms, realRoomID)
+	}
+}
+
+// 记录转发的消息数，本月额度不足时返回false，消息不应再发送
+func (a *Account) Spend(n int) bool {
+	if a == nil {
+		return true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u := a.current()
+	if lim := a.limits(); lim != nil && lim.MessageBudget > 0 && u.Messages+int64(n) > lim.MessageBudget {
+		return false
+	}
+	u.Messages += int64(n)
+	return true
+}
+
+// 退还Spend记录的消息数，用于最终没有发送的消息
+func (a *Account) Refund(n int) {
+	if a == nil || n == 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if u := a.current(); u.Messages >= int64(n) {
+		u.Messages -= int64(n)
+	}
+}
+
+func (a *Account) AddBytes(n int) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.current().BytesOut += int64(n)
+}
+
+// 租户的状态，用于管理接口
+type Status struct {
+	Name          string            `json:"name"`
+	MaxRooms      int               `json:"max_rooms"`
+	MaxConns      int               `json:"max_conns"`
+	MessageBudget int64             `json:"message_budget"`
+	Connections   int               `json:"connections"` // 当前连接数
+	Rooms         []int             `json:"rooms"`       // 当前订阅的房间
+	Usage         map[string]*Usage `json:"usage"`       // 按月份的用量
+}
+
+// 所有配置中的租户及其用量，month不为空时只返回该月的用量
+func List(month string) []Status {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	var list []Status
+	for _, t := range config.GetConfig().Tenants {
+		a := getLocked(t.Name)
+		a.mu.Lock()
+		st := Status{
+			Name:          t.Name,
+			MaxRooms:      t.MaxRooms,
+			MaxConns:      t.MaxConns,
+			MessageBudget: t.MessageBudget,
+			Connections:   a.conns,
+			Rooms:         make([]int, 0, len(a.rooms)),
+			Usage:         make(map[string]*Usage),
+		}
+		for id := range a.rooms {
+			st.Rooms = append(st.Rooms, id)
+		}
+		for m, u := range a.usage {
+			if month == "" || m == month {
+				copied := *u
+				st.Usage[m] = &copied
+			}
+		}
+		a.mu.Unlock()
+		sort.Ints(st.Rooms)
+		list = append(list, st)
+	}
+	return list
+}
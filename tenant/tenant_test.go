@@ -0,0 +1,169 @@
+package tenant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FH-TianHe/BiliMux/config"
+)
+
+// 加载只包含给定租户的配置
+func setTenants(t *testing.T, tenants ...config.Tenant) {
+	t.Helper()
+	data, err := json.Marshal(config.Config{Tenants: tenants})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 将时钟固定在给定时间，测试结束后恢复
+func setNow(t *testing.T, tm *time.Time) {
+	t.Helper()
+	now = func() time.Time { return *tm }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestMonthRollover(t *testing.T) {
+	setTenants(t, config.Tenant{Name: "rollover", MessageBudget: 10})
+	cst := time.FixedZone("CST", 8*3600)
+	clock := time.Date(2026, 1, 31, 23, 59, 59, 0, cst)
+	setNow(t, &clock)
+	a := &Account{Name: "rollover", rooms: make(map[int]int), usage: make(map[string]*Usage)}
+
+	type step struct {
+		at     time.Time
+		spend  int
+		want   bool // Spend的结果
+		wantOp bool // 之后Open是否成功
+	}
+	steps := []step{
+		{time.Date(2026, 1, 31, 23, 59, 59, 0, cst), 10, true, false},
+		{time.Date(2026, 1, 31, 23, 59, 59, 0, cst), 1, false, false},
+		{time.Date(2026, 2, 1, 0, 0, 0, 0, cst), 4, true, true},
+		{time.Date(2026, 2, 28, 12, 0, 0, 0, cst), 7, false, true},
+		{time.Date(2026, 12, 31, 23, 0, 0, 0, cst), 10, true, false},
+		{time.Date(2027, 1, 1, 0, 0, 0, 0, cst), 0, true, true},
+	}
+	for i, s := range steps {
+		clock = s.at
+		if got := a.Spend(s.spend); got != s.want {
+			t.Errorf("步骤 %d %s Spend(%d) = %v, want %v", i, s.at.Format("2006-01-02"), s.spend, got, s.want)
+		}
+		err := a.Open()
+		if (err == nil) != s.wantOp {
+			t.Errorf("步骤 %d %s Open err = %v, wantOp %v", i, s.at.Format("2006-01-02"), err, s.wantOp)
+		}
+		if err == nil {
+			a.Close()
+		}
+	}
+
+	want := map[string]int64{"2026-01": 10, "2026-02": 4, "2026-12": 10, "2027-01": 0}
+	for m, n := range want {
+		u, ok := a.usage[m]
+		if !ok {
+			t.Errorf("没有 %s 的用量", m)
+			continue
+		}
+		if u.Messages != n {
+			t.Errorf("%s 的消息数 = %d, want %d", m, u.Messages, n)
+		}
+	}
+	if len(a.usage) != len(want) {
+		t.Errorf("用量月份 = %d, want %d", len(a.usage), len(want))
+	}
+}
+
+func TestSpendRefund(t *testing.T) {
+	setTenants(t, config.Tenant{Name: "budget", MessageBudget: 5})
+	clock := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	setNow(t, &clock)
+	a := &Account{Name: "budget", rooms: make(map[int]int), usage: make(map[string]*Usage)}
+
+	tests := []struct {
+		name   string
+		spend  int
+		refund int
+		want   bool
+		total  int64
+	}{
+		{"额度内", 3, 0, true, 3},
+		{"超出额度不记录", 3, 0, false, 3},
+		{"刚好用完", 2, 0, true, 5},
+		{"退还后可再发送", 0, 2, true, 3},
+		{"退还不会小于零", 0, 10, true, 3},
+		{"再次用完", 2, 0, true, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.refund > 0 {
+				a.Refund(tt.refund)
+			} else if got := a.Spend(tt.spend); got != tt.want {
+				t.Errorf("Spend(%d) = %v, want %v", tt.spend, got, tt.want)
+			}
+			if got := a.usage["2026-03"].Messages; got != tt.total {
+				t.Errorf("消息数 = %d, want %d", got, tt.total)
+			}
+		})
+	}
+}
+
+func TestNilAccount(t *testing.T) {
+	var a *Account
+	if a.Open() != nil || a.JoinRoom(1) != nil || !a.Spend(1<<30) {
+		t.Error("nil账户不应做任何限制")
+	}
+	a.Refund(1)
+	a.AddBytes(1)
+	a.LeaveRoom(1)
+	a.Close()
+}
+
+func TestOpenLimits(t *testing.T) {
+	setTenants(t, config.Tenant{Name: "conns", MaxConns: 2, MaxRooms: 1})
+	a := &Account{Name: "conns", rooms: make(map[int]int), usage: make(map[string]*Usage)}
+
+	if err := a.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.Open().(*QuotaError); !ok {
+		t.Error("第三个连接应超出配额")
+	}
+	a.Close()
+	if err := a.Open(); err != nil {
+		t.Errorf("释放后应能再次连接: %v", err)
+	}
+
+	if err := a.JoinRoom(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.JoinRoom(1); err != nil {
+		t.Errorf("同一房间不占用新名额: %v", err)
+	}
+	if _, ok := a.JoinRoom(2).(*QuotaError); !ok {
+		t.Error("第二个房间应超出配额")
+	}
+	a.LeaveRoom(1)
+	a.LeaveRoom(1)
+	if err := a.JoinRoom(2); err != nil {
+		t.Errorf("离开后应能订阅其他房间: %v", err)
+	}
+
+	unknown := &Account{Name: "deleted", rooms: make(map[int]int), usage: make(map[string]*Usage)}
+	if _, ok := unknown.Open().(*QuotaError); !ok {
+		t.Error("不存在的租户应被拒绝")
+	}
+}
@@ -1,8 +1,6 @@
 package utils
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"